@@ -3,13 +3,45 @@ package api
 import (
 	"vt-data-pipeline/config"
 	"vt-data-pipeline/handlers"
+	"vt-data-pipeline/jobs"
+	"vt-data-pipeline/metrics"
 	"vt-data-pipeline/redis"
+	"vt-data-pipeline/vtclient"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
 
-func SetupRoutes(r *gin.Engine, db *sqlx.DB, redisClient *redis.Client, cfg *config.Config) {
-	reportHandler := handlers.NewReportHandler(db, redisClient, cfg)
+func SetupRoutes(r *gin.Engine, db *sqlx.DB, redisClient *redis.Client, vtClient vtclient.Client, keyPool *vtclient.KeyPool, queue *jobs.Queue, cfg *config.Config) {
+	reportHandler := handlers.NewReportHandler(db, redisClient, vtClient, queue, cfg)
 	r.GET("/report/:id", reportHandler.GetReport)
+	r.GET("/report/:id/relationships/:name", reportHandler.GetRelationships)
+	r.GET("/report/:id/history", reportHandler.GetHistory)
+	r.GET("/report/:id/diff", reportHandler.GetDiff)
+	r.POST("/reports/batch", reportHandler.GetBatchReports)
+
+	jobHandler := handlers.NewJobHandler(queue)
+	r.POST("/jobs", jobHandler.CreateJob)
+	r.GET("/jobs/:id", jobHandler.GetJob)
+
+	watchlistHandler := handlers.NewWatchlistHandler(db, cfg)
+	r.GET("/watchlist", watchlistHandler.GetWatchlist)
+	r.POST("/watchlist", watchlistHandler.AddToWatchlist)
+	r.DELETE("/watchlist/:id", watchlistHandler.RemoveFromWatchlist)
+
+	alertHandler := handlers.NewAlertHandler(db)
+	r.GET("/alerts", alertHandler.GetAlerts)
+
+	graphHandler := handlers.NewGraphHandler(db)
+	r.GET("/graph/:id", graphHandler.GetGraph)
+
+	searchHandler := handlers.NewSearchHandler(db)
+	r.GET("/ips", searchHandler.SearchIPs)
+	r.GET("/domains", searchHandler.SearchDomains)
+
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	adminHandler := handlers.NewAdminHandler(keyPool)
+	admin := r.Group("/admin", handlers.RequireAdminToken(cfg.Server.AdminToken))
+	admin.GET("/vt/keys", adminHandler.GetVTKeys)
 }
@@ -3,24 +3,76 @@ package config
 import (
 	"errors"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// APIKey is a VirusTotal API key and the quota of its tier
+type APIKey struct {
+	Key               string
+	Tier              string
+	RequestsPerMinute int
+	RequestsPerDay    int
+}
+
 type Config struct {
 	Database struct {
 		URL string
 	}
 	Server struct {
 		Port string
+		// AdminToken protects the /admin endpoints, which are disabled when it is empty
+		AdminToken string
 	}
 	VirusTotal struct {
-		APIKey string
+		APIKeys []APIKey
+		// RateLimitMaxWait is how long a caller queues for a VT token before getting a "quota exhausted" error
+		RateLimitMaxWait time.Duration
+		// CredentialQuarantine and QuotaQuarantine are how long a key is taken out of rotation
+		// after a WrongCredentialsError or QuotaExceededError
+		CredentialQuarantine time.Duration
+		QuotaQuarantine      time.Duration
 	}
 	Redis struct {
 		URL      string
 		Password string
 	}
+	Freshness FreshnessPolicy
+	Jobs      struct {
+		// MaxAttempts is how many times a job is tried before it is marked failed
+		MaxAttempts int
+		// RetryDelay is the first backoff after a transient failure, doubled on every further attempt
+		RetryDelay time.Duration
+		// Concurrency is the number of jobs a worker process runs at once
+		Concurrency int
+		// InlineConsumer runs one job consumer inside the API server, for deployments without a worker
+		InlineConsumer bool
+		// MetricsPort serves /metrics in worker mode, the API server serves it on its own port
+		MetricsPort string
+	}
+	Watchlist struct {
+		// Tick is how often due watchlist entries are queued for refresh
+		Tick time.Duration
+		// BudgetPercent is the share of the daily VT quota scheduled refreshes may use, the rest is kept for users
+		BudgetPercent int
+		// DefaultInterval is used when POST /watchlist gives no interval
+		DefaultInterval time.Duration
+	}
+	Alerts struct {
+		// An alert is raised after a scheduled refresh when malicious_count or suspicious_count rose by at least
+		// MaliciousIncrease/SuspiciousIncrease, reputation fell by at least ReputationDrop,
+		// or at least EngineFlips engines newly flagged the indicator as malicious or suspicious
+		MaliciousIncrease  int
+		SuspiciousIncrease int
+		ReputationDrop     int
+		EngineFlips        int
+		// WebhookURLs receive every alert, signed with WebhookSecret
+		WebhookURLs   []string
+		WebhookSecret string
+	}
 }
 
 func LoadConfig() (*Config, error) {
@@ -29,6 +81,7 @@ func LoadConfig() (*Config, error) {
 	}
 
 	cfg := &Config{}
+	var err error
 
 	if dbURL := os.Getenv("DB_URL"); dbURL != "" {
 		cfg.Database.URL = dbURL
@@ -43,10 +96,69 @@ func LoadConfig() (*Config, error) {
 		cfg.Server.Port = "8080"
 	}
 
+	cfg.Server.AdminToken = os.Getenv("ADMIN_TOKEN")
+
+	// VirusTotal quotas per key tier, free defaults to the public API free tier
+	var free, premium APIKey
+	if free.RequestsPerMinute, err = intEnv("VT_REQUESTS_PER_MINUTE", 4); err != nil {
+		return nil, err
+	}
+	if free.RequestsPerDay, err = intEnv("VT_REQUESTS_PER_DAY", 500); err != nil {
+		return nil, err
+	}
+	if premium.RequestsPerMinute, err = intEnv("VT_PREMIUM_REQUESTS_PER_MINUTE", 1000); err != nil {
+		return nil, err
+	}
+	if premium.RequestsPerDay, err = intEnv("VT_PREMIUM_REQUESTS_PER_DAY", 1000000); err != nil {
+		return nil, err
+	}
+
+	// VT_API_KEYS holds a comma separated pool of keys, each optionally suffixed with its tier (key:premium).
+	// VT_API_KEY is still accepted as a single free key.
+	var rawKeys []string
 	if apiKey := os.Getenv("VT_API_KEY"); apiKey != "" {
-		cfg.VirusTotal.APIKey = apiKey
-	} else {
-		return nil, errors.New("VT_API_KEY is not set")
+		rawKeys = append(rawKeys, apiKey)
+	}
+	if apiKeys := os.Getenv("VT_API_KEYS"); apiKeys != "" {
+		rawKeys = append(rawKeys, strings.Split(apiKeys, ",")...)
+	}
+	seen := map[string]bool{}
+	for _, raw := range rawKeys {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		key, tier, _ := strings.Cut(raw, ":")
+		var apiKey APIKey
+		switch tier {
+		case "", "free":
+			apiKey = free
+			apiKey.Tier = "free"
+		case "premium":
+			apiKey = premium
+			apiKey.Tier = "premium"
+		default:
+			return nil, errors.New("unknown VirusTotal key tier: " + tier + " (allowed: free, premium)")
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		apiKey.Key = key
+		cfg.VirusTotal.APIKeys = append(cfg.VirusTotal.APIKeys, apiKey)
+	}
+	if len(cfg.VirusTotal.APIKeys) == 0 {
+		return nil, errors.New("VT_API_KEY or VT_API_KEYS is not set")
+	}
+
+	if cfg.VirusTotal.RateLimitMaxWait, err = durationEnv("VT_RATE_LIMIT_MAX_WAIT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.VirusTotal.CredentialQuarantine, err = durationEnv("VT_KEY_CREDENTIAL_QUARANTINE", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.VirusTotal.QuotaQuarantine, err = durationEnv("VT_KEY_QUOTA_QUARANTINE", time.Hour); err != nil {
+		return nil, err
 	}
 
 	// Redis configuration
@@ -58,5 +170,131 @@ func LoadConfig() (*Config, error) {
 
 	cfg.Redis.Password = os.Getenv("REDIS_PASSWORD")
 
+	// Freshness policy, per report type with tighter limits for risky indicators
+	cfg.Freshness = FreshnessPolicy{
+		MaxAge:   map[string]time.Duration{},
+		CacheTTL: map[string]time.Duration{},
+	}
+	defaultMaxAge := map[string]time.Duration{"domains": 24 * time.Hour, "ip_addresses": 24 * time.Hour, "urls": 24 * time.Hour, "files": 72 * time.Hour}
+	defaultCacheTTL := map[string]time.Duration{"domains": time.Hour, "ip_addresses": time.Hour, "urls": time.Hour, "files": 6 * time.Hour}
+	for reportType, maxAge := range defaultMaxAge {
+		name := strings.ToUpper(reportType)
+		if cfg.Freshness.MaxAge[reportType], err = durationEnv("FRESHNESS_"+name+"_MAX_AGE", maxAge); err != nil {
+			return nil, err
+		}
+		if cfg.Freshness.CacheTTL[reportType], err = durationEnv("CACHE_"+name+"_TTL", defaultCacheTTL[reportType]); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Freshness.RiskyMaxAge, err = durationEnv("FRESHNESS_RISKY_MAX_AGE", 6*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.Freshness.RiskyCacheTTL, err = durationEnv("CACHE_RISKY_TTL", 15*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.Freshness.StaleWhileRevalidate, err = boolEnv("STALE_WHILE_REVALIDATE", false); err != nil {
+		return nil, err
+	}
+	if cfg.Freshness.MaxStale, err = durationEnv("STALE_MAX_AGE", 7*24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.Freshness.NotFoundTTL, err = durationEnv("NOT_FOUND_TTL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+
+	// Asynchronous fetch jobs
+	if cfg.Jobs.MaxAttempts, err = intEnv("JOBS_MAX_ATTEMPTS", 5); err != nil {
+		return nil, err
+	}
+	if cfg.Jobs.RetryDelay, err = durationEnv("JOBS_RETRY_DELAY", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.Jobs.Concurrency, err = intEnv("WORKER_CONCURRENCY", 4); err != nil {
+		return nil, err
+	}
+	if cfg.Jobs.InlineConsumer, err = boolEnv("JOBS_INLINE_CONSUMER", true); err != nil {
+		return nil, err
+	}
+	cfg.Jobs.MetricsPort = os.Getenv("WORKER_METRICS_PORT")
+	if cfg.Jobs.MetricsPort == "" {
+		cfg.Jobs.MetricsPort = "9091"
+	}
+
+	// Scheduled refresh of watched indicators
+	if cfg.Watchlist.Tick, err = durationEnv("WATCHLIST_TICK", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.Watchlist.Tick == 0 {
+		return nil, errors.New("WATCHLIST_TICK must be greater than zero")
+	}
+	if cfg.Watchlist.BudgetPercent, err = intEnv("WATCHLIST_BUDGET_PERCENT", 50); err != nil {
+		return nil, err
+	}
+	if cfg.Watchlist.BudgetPercent < 1 || cfg.Watchlist.BudgetPercent > 100 {
+		return nil, errors.New("WATCHLIST_BUDGET_PERCENT must be between 1 and 100")
+	}
+	if cfg.Watchlist.DefaultInterval, err = durationEnv("WATCHLIST_DEFAULT_INTERVAL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+
+	// Alert thresholds and delivery
+	if cfg.Alerts.MaliciousIncrease, err = intEnv("ALERT_MALICIOUS_INCREASE", 1); err != nil {
+		return nil, err
+	}
+	if cfg.Alerts.SuspiciousIncrease, err = intEnv("ALERT_SUSPICIOUS_INCREASE", 3); err != nil {
+		return nil, err
+	}
+	if cfg.Alerts.ReputationDrop, err = intEnv("ALERT_REPUTATION_DROP", 10); err != nil {
+		return nil, err
+	}
+	if cfg.Alerts.EngineFlips, err = intEnv("ALERT_ENGINE_FLIPS", 1); err != nil {
+		return nil, err
+	}
+	for _, url := range strings.Split(os.Getenv("ALERT_WEBHOOK_URLS"), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			cfg.Alerts.WebhookURLs = append(cfg.Alerts.WebhookURLs, url)
+		}
+	}
+	cfg.Alerts.WebhookSecret = os.Getenv("ALERT_WEBHOOK_SECRET")
+
 	return cfg, nil
 }
+
+// intEnv reads a positive integer from the environment, falling back to def when unset
+func intEnv(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, errors.New(name + " must be a positive integer")
+	}
+	return n, nil
+}
+
+// durationEnv reads a non-negative duration (e.g. 30s) from the environment, falling back to def when unset
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, errors.New(name + " must be a non-negative duration such as 30s")
+	}
+	return d, nil
+}
+
+// boolEnv reads a boolean (true/false, 1/0) from the environment, falling back to def when unset
+func boolEnv(name string, def bool) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New(name + " must be true or false")
+	}
+	return b, nil
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "", want: 4},
+		{value: "500", want: 500},
+		{value: "0", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "1.5", wantErr: true},
+		{value: "ten", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_INT", tt.value)
+		got, err := intEnv("TEST_INT", 4)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("intEnv(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("intEnv(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDurationEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: 30 * time.Second},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: "0", want: 0},
+		{value: "-1s", wantErr: true},
+		{value: "30", wantErr: true},
+		{value: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_DURATION", tt.value)
+		got, err := durationEnv("TEST_DURATION", 30*time.Second)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("durationEnv(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("durationEnv(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestBoolEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		def     bool
+		want    bool
+		wantErr bool
+	}{
+		{value: "", def: true, want: true},
+		{value: "", def: false, want: false},
+		{value: "false", def: true, want: false},
+		{value: "TRUE", want: true},
+		{value: "1", want: true},
+		{value: "0", def: true, want: false},
+		{value: "yes", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_BOOL", tt.value)
+		got, err := boolEnv("TEST_BOOL", tt.def)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("boolEnv(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("boolEnv(%q) with default %v = %v, want %v", tt.value, tt.def, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package config
+
+import "time"
+
+// Freshness defaults, used for report types without a configured value
+const (
+	DefaultMaxAge      = 24 * time.Hour
+	DefaultCacheTTL    = time.Hour
+	DefaultNotFoundTTL = 24 * time.Hour
+)
+
+// FreshnessPolicy decides how long stored and cached reports are served before VirusTotal is asked again.
+// Indicators with malicious or suspicious detections are held to the tighter risky limits.
+type FreshnessPolicy struct {
+	// MaxAge is, per report type, how old DB data may be before it is refetched
+	MaxAge map[string]time.Duration
+	// CacheTTL is, per report type, how long a report stays in Redis
+	CacheTTL map[string]time.Duration
+	// RiskyMaxAge and RiskyCacheTTL cap MaxAge and CacheTTL for risky indicators
+	RiskyMaxAge   time.Duration
+	RiskyCacheTTL time.Duration
+	// StaleWhileRevalidate serves stale DB data at once and refreshes it in the background
+	StaleWhileRevalidate bool
+	// MaxStale is the oldest DB data served that way, older data blocks on VirusTotal again
+	MaxStale time.Duration
+	// NotFoundTTL is how long a NotFoundError from VirusTotal is remembered
+	NotFoundTTL time.Duration
+}
+
+// MaxAgeFor returns the maximum age of DB data of a report type
+func (p FreshnessPolicy) MaxAgeFor(reportType string, risky bool) time.Duration {
+	maxAge, ok := p.MaxAge[reportType]
+	if !ok || maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	if risky && p.RiskyMaxAge > 0 {
+		maxAge = min(maxAge, p.RiskyMaxAge)
+	}
+	return maxAge
+}
+
+// CacheTTLFor returns the Redis TTL of a report type
+func (p FreshnessPolicy) CacheTTLFor(reportType string, risky bool) time.Duration {
+	ttl, ok := p.CacheTTL[reportType]
+	if !ok || ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	if risky && p.RiskyCacheTTL > 0 {
+		ttl = min(ttl, p.RiskyCacheTTL)
+	}
+	return ttl
+}
+
+// NotFoundTTLFor returns how long indicators unknown to VirusTotal stay in the negative cache
+func (p FreshnessPolicy) NotFoundTTLFor() time.Duration {
+	if p.NotFoundTTL <= 0 {
+		return DefaultNotFoundTTL
+	}
+	return p.NotFoundTTL
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFreshnessPolicy(t *testing.T) {
+	policy := FreshnessPolicy{
+		MaxAge:        map[string]time.Duration{"domains": 24 * time.Hour, "files": 72 * time.Hour, "urls": 0},
+		CacheTTL:      map[string]time.Duration{"domains": time.Hour, "files": 6 * time.Hour},
+		RiskyMaxAge:   6 * time.Hour,
+		RiskyCacheTTL: 15 * time.Minute,
+	}
+	tests := []struct {
+		reportType   string
+		risky        bool
+		wantMaxAge   time.Duration
+		wantCacheTTL time.Duration
+	}{
+		{"domains", false, 24 * time.Hour, time.Hour},
+		{"domains", true, 6 * time.Hour, 15 * time.Minute},
+		{"files", false, 72 * time.Hour, 6 * time.Hour},
+		{"files", true, 6 * time.Hour, 15 * time.Minute},
+		{"urls", false, DefaultMaxAge, DefaultCacheTTL},
+		{"ip_addresses", false, DefaultMaxAge, DefaultCacheTTL},
+	}
+	for _, tt := range tests {
+		if got := policy.MaxAgeFor(tt.reportType, tt.risky); got != tt.wantMaxAge {
+			t.Errorf("MaxAgeFor(%q, risky=%v) = %v, want %v", tt.reportType, tt.risky, got, tt.wantMaxAge)
+		}
+		if got := policy.CacheTTLFor(tt.reportType, tt.risky); got != tt.wantCacheTTL {
+			t.Errorf("CacheTTLFor(%q, risky=%v) = %v, want %v", tt.reportType, tt.risky, got, tt.wantCacheTTL)
+		}
+	}
+
+	// Risky limits only tighten, they never extend a shorter configured value
+	short := FreshnessPolicy{
+		MaxAge:        map[string]time.Duration{"domains": time.Hour},
+		CacheTTL:      map[string]time.Duration{"domains": 5 * time.Minute},
+		RiskyMaxAge:   6 * time.Hour,
+		RiskyCacheTTL: 15 * time.Minute,
+	}
+	if got := short.MaxAgeFor("domains", true); got != time.Hour {
+		t.Errorf("MaxAgeFor with a shorter max age than the risky cap = %v, want %v", got, time.Hour)
+	}
+	if got := short.CacheTTLFor("domains", true); got != 5*time.Minute {
+		t.Errorf("CacheTTLFor with a shorter TTL than the risky cap = %v, want %v", got, 5*time.Minute)
+	}
+}
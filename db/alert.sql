@@ -0,0 +1,18 @@
+-- Alerts raised when a scheduled refresh crosses a verdict threshold
+CREATE TABLE alerts (
+    id BIGSERIAL PRIMARY KEY,
+    indicator VARCHAR(255) NOT NULL, -- Domain name or IP address
+    type VARCHAR(20) NOT NULL, -- domains or ip_addresses
+    reasons JSONB NOT NULL, -- Thresholds that were crossed
+    diff JSONB NOT NULL, -- Difference between the two snapshots
+    from_snapshot_id BIGINT NOT NULL, -- Previous snapshot
+    to_snapshot_id BIGINT NOT NULL, -- Snapshot written by the refresh
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP, -- When every webhook accepted the alert
+    delivery_error TEXT -- Last webhook delivery error
+);
+
+-- Indexes for performance
+CREATE INDEX idx_alerts_created_at ON alerts (created_at);
+
+CREATE INDEX idx_alerts_indicator ON alerts (indicator, type);
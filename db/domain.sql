@@ -69,4 +69,66 @@ CREATE INDEX idx_domain_analysis_results_domain_id ON domain_analysis_results (d
 
 CREATE INDEX idx_domain_details_domain_id ON domain_details (domain_id);
 
-CREATE INDEX idx_domain_cache_expires_at ON domain_cache (expires_at);
\ No newline at end of file
+CREATE INDEX idx_domain_cache_expires_at ON domain_cache (expires_at);
+
+-- Indexes for pivoting (graph endpoint)
+CREATE INDEX idx_domains_registrar ON domains (registrar);
+
+CREATE INDEX idx_domain_details_dns_records ON domain_details USING GIN (last_dns_records jsonb_path_ops);
+
+CREATE INDEX idx_domain_details_certificate_thumbprint ON domain_details ((last_https_certificate->>'thumbprint_sha256'));
+
+-- Indexes for searching (GET /domains)
+CREATE INDEX idx_domains_tld ON domains (tld);
+
+CREATE INDEX idx_domains_registrar_lower ON domains (lower(registrar));
+
+CREATE INDEX idx_domains_creation_date ON domains (creation_date);
+
+CREATE INDEX idx_domains_expiration_date ON domains (expiration_date);
+
+CREATE INDEX idx_domains_malicious_count ON domains (malicious_count);
+
+CREATE INDEX idx_domain_categories_category ON domain_categories (lower(category));
+
+CREATE INDEX idx_domain_details_whois_fts ON domain_details USING GIN (to_tsvector('simple', COALESCE(whois, '')));
+
+-- Keyset indexes for the sort orders of GET /domains. The expressions must match the keys in
+-- repositories.DomainSortOrders exactly: ascending orders put NULLs last with 'infinity', descending ones with '-infinity'.
+-- Descending orders scan these indexes backward. sort=id uses the primary key.
+CREATE INDEX idx_domains_sort_creation_date_asc ON domains ((COALESCE(creation_date, 'infinity'::timestamp)), id);
+
+CREATE INDEX idx_domains_sort_creation_date_desc ON domains ((COALESCE(creation_date, '-infinity'::timestamp)), id);
+
+CREATE INDEX idx_domains_sort_expiration_date_asc ON domains ((COALESCE(expiration_date, 'infinity'::timestamp)), id);
+
+CREATE INDEX idx_domains_sort_expiration_date_desc ON domains ((COALESCE(expiration_date, '-infinity'::timestamp)), id);
+
+CREATE INDEX idx_domains_sort_last_analysis_date_asc ON domains ((COALESCE(last_analysis_date, 'infinity'::timestamp)), id);
+
+CREATE INDEX idx_domains_sort_last_analysis_date_desc ON domains ((COALESCE(last_analysis_date, '-infinity'::timestamp)), id);
+
+CREATE INDEX idx_domains_sort_reputation_asc ON domains ((COALESCE(reputation, 2147483647)), id);
+
+CREATE INDEX idx_domains_sort_reputation_desc ON domains ((COALESCE(reputation, -2147483648)), id);
+
+
+-- Append-only history of domain reports, one row per VirusTotal fetch
+CREATE TABLE domain_snapshots (
+    id BIGSERIAL PRIMARY KEY,
+    domain_id VARCHAR(255) REFERENCES domains (id) ON DELETE CASCADE,
+    fetched_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- When the report was fetched from VirusTotal
+    last_analysis_date TIMESTAMP, -- Last VirusTotal analysis at fetch time
+    reputation INTEGER, -- Reputation score
+    harmless_count INTEGER, -- From last_analysis_stats
+    malicious_count INTEGER, -- From last_analysis_stats
+    suspicious_count INTEGER, -- From last_analysis_stats
+    undetected_count INTEGER, -- From last_analysis_stats
+    timeout_count INTEGER, -- From last_analysis_stats
+    verdicts JSONB, -- Per-engine category (engine -> category)
+    dns_records JSONB, -- last_dns_records at fetch time
+    certificate_thumbprint VARCHAR(64), -- SHA-256 thumbprint of last_https_certificate
+    response_hash CHAR(64) -- SHA-256 of the decoded VirusTotal response
+);
+
+CREATE INDEX idx_domain_snapshots_domain_id_fetched_at ON domain_snapshots (domain_id, fetched_at);
@@ -0,0 +1,58 @@
+-- Table for file metadata
+CREATE TABLE files (
+    id CHAR(64) PRIMARY KEY, -- SHA-256 of the file
+    type VARCHAR(50) NOT NULL, -- 'files'
+    md5 CHAR(32), -- MD5 of the file
+    sha1 CHAR(40), -- SHA-1 of the file
+    size BIGINT, -- Size in bytes
+    type_description VARCHAR(255), -- e.g., Win32 EXE
+    type_tag VARCHAR(50), -- e.g., peexe
+    meaningful_name VARCHAR(255), -- Most interesting submitted name
+    magic TEXT, -- libmagic description
+    first_submission_date TIMESTAMP, -- First submission to VirusTotal
+    last_submission_date TIMESTAMP, -- Last submission to VirusTotal
+    last_analysis_date TIMESTAMP, -- Last VirusTotal analysis
+    times_submitted INTEGER, -- Number of submissions
+    reputation INTEGER, -- Reputation score
+    signature_info JSONB, -- Authenticode signature details
+    last_analysis_stats JSONB, -- Full last_analysis_stats including type-unsupported and failure
+    harmless_count INTEGER, -- From last_analysis_stats
+    malicious_count INTEGER, -- From last_analysis_stats
+    suspicious_count INTEGER, -- From last_analysis_stats
+    undetected_count INTEGER, -- From last_analysis_stats
+    timeout_count INTEGER, -- From last_analysis_stats
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Table for file names (many-to-one with files)
+CREATE TABLE file_names (
+    id SERIAL PRIMARY KEY,
+    file_id CHAR(64) REFERENCES files (id) ON DELETE CASCADE,
+    name TEXT, -- e.g., invoice.pdf.exe
+    UNIQUE (file_id, name)
+);
+
+-- Table for file analysis results (many-to-one with files)
+CREATE TABLE file_analysis_results (
+    id SERIAL PRIMARY KEY,
+    file_id CHAR(64) REFERENCES files (id) ON DELETE CASCADE,
+    engine_name VARCHAR(100), -- e.g., BitDefender
+    category VARCHAR(50), -- e.g., malicious, undetected
+    result VARCHAR(255), -- e.g., Trojan.GenericKD.1234
+    method VARCHAR(50), -- e.g., blacklist
+    UNIQUE (file_id, engine_name)
+);
+
+-- Indexes for performance
+CREATE INDEX idx_files_md5 ON files (md5);
+
+CREATE INDEX idx_files_sha1 ON files (sha1);
+
+CREATE INDEX idx_files_last_analysis_date ON files (last_analysis_date);
+
+CREATE INDEX idx_files_reputation ON files (reputation);
+
+CREATE INDEX idx_file_names_file_id ON file_names (file_id);
+
+CREATE INDEX idx_file_analysis_results_file_id ON file_analysis_results (file_id);
@@ -1,6 +1,6 @@
 -- Table for IP metadata
 CREATE TABLE ip_addresses (
-    id VARCHAR(255) PRIMARY KEY, -- IP address (e.g., 185.189.112.27)
+    id VARCHAR(255) PRIMARY KEY, -- Canonical IP address (e.g., 185.189.112.27 or 2001:4860:4860::8888)
     type VARCHAR(50) NOT NULL, -- 'ip_address'
     last_analysis_date TIMESTAMP, -- Last VirusTotal analysis
     asn INTEGER, -- Autonomous System Number
@@ -8,7 +8,8 @@ CREATE TABLE ip_addresses (
     country VARCHAR(2), -- Country code (e.g., DE)
     as_owner VARCHAR(255), -- AS owner (e.g., M247 Europe SRL)
     regional_internet_registry VARCHAR(50), -- e.g., RIPE NCC
-    network VARCHAR(50), -- e.g., 185.189.112.0/22
+    network CIDR, -- e.g., 185.189.112.0/22 or 2001:4860::/32
+    address INET GENERATED ALWAYS AS (id::inet) STORED, -- id as inet, for CIDR searches
     whois_date TIMESTAMP, -- WHOIS data timestamp
     last_modification_date TIMESTAMP, -- Last modification
     continent VARCHAR(2), -- Continent code (e.g., EU)
@@ -57,4 +58,40 @@ CREATE INDEX idx_ip_tags_ip_id ON ip_tags (ip_id);
 
 CREATE INDEX idx_ip_analysis_results_ip_id ON ip_analysis_results (ip_id);
 
-CREATE INDEX idx_ip_details_ip_id ON ip_details (ip_id);
\ No newline at end of file
+CREATE INDEX idx_ip_details_ip_id ON ip_details (ip_id);
+
+-- Indexes for pivoting (graph endpoint)
+CREATE INDEX idx_ip_addresses_network ON ip_addresses USING GIST (network inet_ops);
+
+CREATE INDEX idx_ip_addresses_asn ON ip_addresses (asn);
+
+-- Indexes for searching (GET /ips)
+CREATE INDEX idx_ip_addresses_address ON ip_addresses USING GIST (address inet_ops);
+
+CREATE INDEX idx_ip_addresses_country ON ip_addresses (country);
+
+CREATE INDEX idx_ip_addresses_malicious_count ON ip_addresses (malicious_count);
+
+-- Existing databases:
+-- ALTER TABLE ip_addresses ALTER COLUMN network TYPE CIDR USING NULLIF(network, '')::cidr;
+-- ALTER TABLE ip_addresses ADD COLUMN address INET GENERATED ALWAYS AS (id::inet) STORED;
+
+
+-- Append-only history of IP reports, one row per VirusTotal fetch
+CREATE TABLE ip_snapshots (
+    id BIGSERIAL PRIMARY KEY,
+    ip_id VARCHAR(255) REFERENCES ip_addresses (id) ON DELETE CASCADE,
+    fetched_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- When the report was fetched from VirusTotal
+    last_analysis_date TIMESTAMP, -- Last VirusTotal analysis at fetch time
+    reputation INTEGER, -- Reputation score
+    harmless_count INTEGER, -- From last_analysis_stats
+    malicious_count INTEGER, -- From last_analysis_stats
+    suspicious_count INTEGER, -- From last_analysis_stats
+    undetected_count INTEGER, -- From last_analysis_stats
+    timeout_count INTEGER, -- From last_analysis_stats
+    verdicts JSONB, -- Per-engine category (engine -> category)
+    tags JSONB, -- Tags at fetch time
+    response_hash CHAR(64) -- SHA-256 of the decoded VirusTotal response
+);
+
+CREATE INDEX idx_ip_snapshots_ip_id_fetched_at ON ip_snapshots (ip_id, fetched_at);
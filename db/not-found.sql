@@ -0,0 +1,13 @@
+-- Indicators VirusTotal reported as unknown, so typos and junk do not spend quota on every lookup
+CREATE TABLE not_found_indicators (
+    indicator VARCHAR(255) NOT NULL, -- Domain, IP, URL identifier or file hash as it was looked up
+    type VARCHAR(20) NOT NULL, -- domains, ip_addresses, urls or files
+    first_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- First NotFoundError from VirusTotal
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Latest NotFoundError from VirusTotal
+    not_found_count INTEGER NOT NULL DEFAULT 1, -- How often VirusTotal answered NotFoundError
+    expires_at TIMESTAMP NOT NULL, -- When the indicator is looked up on VirusTotal again
+    PRIMARY KEY (indicator, type)
+);
+
+-- Indexes for performance
+CREATE INDEX idx_not_found_indicators_expires_at ON not_found_indicators (expires_at);
@@ -0,0 +1,28 @@
+-- Edge table for VirusTotal relationships between indicators
+CREATE TABLE relationships (
+    id SERIAL PRIMARY KEY,
+    source_type VARCHAR(50) NOT NULL, -- e.g., domains
+    source_id TEXT NOT NULL, -- e.g., google.com
+    relation VARCHAR(50) NOT NULL, -- e.g., resolutions
+    target_type VARCHAR(50) NOT NULL, -- e.g., ip_addresses
+    target_id TEXT NOT NULL, -- e.g., 142.250.185.78
+    first_seen TIMESTAMP, -- First time the relationship was observed
+    last_seen TIMESTAMP, -- Last time the relationship was observed
+    UNIQUE (source_type, source_id, relation, target_type, target_id)
+);
+
+-- Table tracking when a relationship was last ingested from VirusTotal
+CREATE TABLE relationship_fetches (
+    source_type VARCHAR(50) NOT NULL,
+    source_id TEXT NOT NULL,
+    relation VARCHAR(50) NOT NULL,
+    fetched_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (source_type, source_id, relation)
+);
+
+-- Indexes for performance
+CREATE INDEX idx_relationships_source ON relationships (source_type, source_id, relation);
+
+CREATE INDEX idx_relationships_target ON relationships (target_type, target_id);
+
+CREATE INDEX idx_relationships_last_seen ON relationships (last_seen);
@@ -0,0 +1,55 @@
+-- Table for URL metadata
+CREATE TABLE urls (
+    id TEXT PRIMARY KEY, -- VirusTotal URL identifier (unpadded base64url of the URL)
+    type VARCHAR(50) NOT NULL, -- 'urls'
+    url TEXT NOT NULL, -- URL as submitted
+    last_final_url TEXT, -- URL after following redirects
+    title TEXT, -- HTML title of the final page
+    first_submission_date TIMESTAMP, -- First submission to VirusTotal
+    last_submission_date TIMESTAMP, -- Last submission to VirusTotal
+    last_analysis_date TIMESTAMP, -- Last VirusTotal analysis
+    reputation INTEGER, -- Reputation score
+    times_submitted INTEGER, -- Number of submissions
+    last_http_response_code INTEGER, -- e.g., 200
+    harmless_count INTEGER, -- From last_analysis_stats
+    malicious_count INTEGER, -- From last_analysis_stats
+    suspicious_count INTEGER, -- From last_analysis_stats
+    undetected_count INTEGER, -- From last_analysis_stats
+    timeout_count INTEGER, -- From last_analysis_stats
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Table for URL analysis results (many-to-one with urls)
+CREATE TABLE url_analysis_results (
+    id SERIAL PRIMARY KEY,
+    url_id TEXT REFERENCES urls (id) ON DELETE CASCADE,
+    engine_name VARCHAR(100), -- e.g., BitDefender
+    category VARCHAR(50), -- e.g., harmless, malicious
+    result VARCHAR(50), -- e.g., clean, phishing
+    method VARCHAR(50), -- e.g., blacklist
+    UNIQUE (url_id, engine_name)
+);
+
+-- Table for additional URL JSONB data (categories, redirects, HTTP response, etc.)
+CREATE TABLE url_details (
+    id SERIAL PRIMARY KEY,
+    url_id TEXT UNIQUE REFERENCES urls (id) ON DELETE CASCADE,
+    categories JSONB, -- Engine categories (engine -> category)
+    tags JSONB, -- Tags
+    threat_names JSONB, -- Threat names reported by engines
+    redirection_chain JSONB, -- Redirects followed to reach the final URL
+    last_http_response_headers JSONB, -- Response headers of the last crawl
+    outgoing_links JSONB, -- Links found on the page
+    html_meta JSONB, -- HTML meta tags
+    total_votes JSONB -- Store votes (harmless, malicious)
+);
+
+-- Indexes for performance
+CREATE INDEX idx_urls_last_analysis_date ON urls (last_analysis_date);
+
+CREATE INDEX idx_urls_reputation ON urls (reputation);
+
+CREATE INDEX idx_url_analysis_results_url_id ON url_analysis_results (url_id);
+
+CREATE INDEX idx_url_details_url_id ON url_details (url_id);
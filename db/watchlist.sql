@@ -0,0 +1,18 @@
+-- Indicators re-fetched on a schedule
+CREATE TABLE watchlist (
+    id SERIAL PRIMARY KEY,
+    indicator VARCHAR(255) NOT NULL, -- Domain name or IP address
+    type VARCHAR(20) NOT NULL, -- domains or ip_addresses
+    refresh_interval_seconds INTEGER NOT NULL, -- How often the indicator is re-fetched
+    next_refresh_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- When the indicator is due again
+    last_enqueued_at TIMESTAMP, -- When the scheduler last queued a refresh
+    last_evaluated_snapshot_id BIGINT, -- Snapshot the next alert evaluation is diffed against (domain_snapshots or ip_snapshots)
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (indicator, type)
+);
+
+-- Indexes for performance
+CREATE INDEX idx_watchlist_next_refresh_at ON watchlist (next_refresh_at);
+
+-- Existing databases:
+-- ALTER TABLE watchlist ADD COLUMN last_evaluated_snapshot_id BIGINT;
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"vt-data-pipeline/vtclient"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler exposes operational state of the pipeline
+type AdminHandler struct {
+	keyPool *vtclient.KeyPool
+}
+
+// NewAdminHandler creates a new AdminHandler instance
+func NewAdminHandler(keyPool *vtclient.KeyPool) *AdminHandler {
+	return &AdminHandler{
+		keyPool: keyPool,
+	}
+}
+
+// GetVTKeys returns the remaining quota, quarantine state and usage counters of every VirusTotal key
+func (h *AdminHandler) GetVTKeys(c *gin.Context) {
+	usage, err := h.keyPool.Usage(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": usage})
+}
+
+// RequireAdminToken rejects requests without a matching "Authorization: Bearer <token>" header.
+// Without a configured token the admin endpoints are disabled and answer 403.
+func RequireAdminToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin endpoints are disabled, set ADMIN_TOKEN to enable them"})
+			return
+		}
+		expected := "Bearer " + token
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte(expected)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+			return
+		}
+		c.Next()
+	}
+}
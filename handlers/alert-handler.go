@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"vt-data-pipeline/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// AlertHandler lists the alerts raised for watched indicators
+type AlertHandler struct {
+	db *sqlx.DB
+}
+
+// NewAlertHandler creates a new AlertHandler instance
+func NewAlertHandler(db *sqlx.DB) *AlertHandler {
+	return &AlertHandler{
+		db: db,
+	}
+}
+
+// GetAlerts handles GET /alerts?indicator=&type=&since=&limit=&offset=, newest first
+func (h *AlertHandler) GetAlerts(c *gin.Context) {
+	since, err := queryTime(c, "since", time.Time{})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, err := queryInt(c, "limit", 100, 1, 1000)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset, err := queryInt(c, "offset", 0, 0, 1<<30)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alerts, err := services.FetchAlerts(c.Query("indicator"), c.Query("type"), since, limit, offset, h.db)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alerts": alerts, "limit": limit, "offset": offset})
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetBatchReports handles POST /reports/batch with a body of {"items": [{"id": ..., "type": ...}]}.
+// Every item gets its own status, so one bad indicator does not fail the batch.
+// Misses are queued as fetch jobs and come back with status queued and the job_id to poll.
+// The max_age= and force_refresh= query parameters apply to every item.
+func (h *ReportHandler) GetBatchReports(c *gin.Context) {
+	opts, err := h.fetchOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var request models.BatchRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body: " + err.Error()})
+		return
+	}
+	if len(request.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "items must not be empty"})
+		return
+	}
+	if len(request.Items) > services.MaxBatchItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d items are allowed per batch", services.MaxBatchItems)})
+		return
+	}
+
+	results, err := services.FetchBatchReports(request.Items, opts, h.db, h.redisClient, h.queue)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"vt-data-pipeline/indicator"
+	"vt-data-pipeline/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDiff handles GET /report/:id/diff?type=...&from=&to=.
+// It compares the snapshots in effect at from and at to: engine verdict flips, reputation and stats,
+// tags for IPs, DNS records and the HTTPS certificate for domains.
+func (h *ReportHandler) GetDiff(c *gin.Context) {
+	reportType := c.Query("type")
+
+	if reportType != "domains" && reportType != "ip_addresses" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "diff is only supported for domains or ip_addresses"})
+		return
+	}
+	id, err := indicator.Normalize(reportType, c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if c.Query("from") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from is required"})
+		return
+	}
+
+	from, err := queryTime(c, "from", time.Time{})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := queryEndTime(c, "to", time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return
+	}
+
+	diff, err := services.FetchDiff(id, reportType, from, to, h.db)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"vt-data-pipeline/indicator"
+	"vt-data-pipeline/jobs"
+	"vt-data-pipeline/ratelimit"
+	"vt-data-pipeline/services"
+	"vt-data-pipeline/vtclient"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondError translates service errors into HTTP responses.
+// VirusTotal errors keep their meaning for the caller instead of becoming a blanket 500.
+func respondError(c *gin.Context, err error) {
+	var apiErr *vtclient.APIError
+	var quotaErr *ratelimit.QuotaExhaustedError
+	var notFoundErr *services.NotFoundCachedError
+	switch {
+	case errors.Is(err, indicator.ErrInvalid), errors.Is(err, services.ErrUnsupportedRelationship), errors.Is(err, services.ErrUnsupportedType),
+		errors.Is(err, services.ErrInvalidWatch), errors.Is(err, services.ErrInvalidSearch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.As(err, &quotaErr):
+		retryAfter := int(math.Ceil(quotaErr.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": quotaErr.Error(), "retry_after": retryAfter})
+	case errors.Is(err, services.ErrNotStored), errors.Is(err, jobs.ErrJobNotFound), errors.Is(err, services.ErrNotWatched):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.As(err, &notFoundErr):
+		c.JSON(http.StatusNotFound, gin.H{"error": "indicator not found on VirusTotal", "cached_until": notFoundErr.Until})
+	case errors.Is(err, vtclient.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "indicator not found on VirusTotal"})
+	case errors.Is(err, vtclient.ErrQuotaExceeded):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "VirusTotal quota exceeded, retry later"})
+	case errors.Is(err, vtclient.ErrWrongCredentials):
+		c.JSON(http.StatusBadGateway, gin.H{"error": "VirusTotal rejected the configured API key"})
+	case errors.As(err, &apiErr):
+		c.JSON(http.StatusBadGateway, gin.H{"error": apiErr.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+
+	"vt-data-pipeline/indicator"
+	"vt-data-pipeline/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// GraphHandler serves pivot graphs over the stored indicators
+type GraphHandler struct {
+	db *sqlx.DB
+}
+
+// NewGraphHandler creates a new GraphHandler instance
+func NewGraphHandler(db *sqlx.DB) *GraphHandler {
+	return &GraphHandler{
+		db: db,
+	}
+}
+
+// GetGraph handles GET /graph/:id?type=...&depth=N.
+// The graph is built from local tables only and never calls VirusTotal.
+func (h *GraphHandler) GetGraph(c *gin.Context) {
+	reportType := c.Query("type")
+
+	if reportType != "domains" && reportType != "ip_addresses" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "graph is only supported for domains or ip_addresses"})
+		return
+	}
+	id, err := indicator.Normalize(reportType, c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	depth, err := queryInt(c, "depth", 1, 1, services.MaxGraphDepth)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	graph, err := services.BuildGraph(id, reportType, depth, h.db)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, graph)
+}
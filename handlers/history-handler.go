@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"vt-data-pipeline/indicator"
+	"vt-data-pipeline/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetHistory handles GET /report/:id/history?type=...&from=&to=.
+// It lists the snapshots written on each VirusTotal fetch, newest first.
+func (h *ReportHandler) GetHistory(c *gin.Context) {
+	reportType := c.Query("type")
+
+	if reportType != "domains" && reportType != "ip_addresses" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "history is only supported for domains or ip_addresses"})
+		return
+	}
+	id, err := indicator.Normalize(reportType, c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	from, err := queryTime(c, "from", time.Time{})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := queryEndTime(c, "to", time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must not be before from"})
+		return
+	}
+	limit, err := queryInt(c, "limit", 100, 1, 1000)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	snapshots, err := services.FetchHistory(id, reportType, from, to, limit, h.db)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":        id,
+		"type":      reportType,
+		"from":      from,
+		"to":        to,
+		"snapshots": snapshots,
+	})
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"vt-data-pipeline/indicator"
+	"vt-data-pipeline/jobs"
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxJobWait bounds how long GET /jobs/:id?wait= holds the request open
+const maxJobWait = time.Minute
+
+// JobHandler handles asynchronous fetch jobs
+type JobHandler struct {
+	queue *jobs.Queue
+}
+
+// NewJobHandler creates a new JobHandler instance
+func NewJobHandler(queue *jobs.Queue) *JobHandler {
+	return &JobHandler{
+		queue: queue,
+	}
+}
+
+// CreateJob handles POST /jobs with a body of {"id": ..., "type": ...} and an optional "force_refresh": true.
+// Without a type it is inferred from the id.
+func (h *JobHandler) CreateJob(c *gin.Context) {
+	var request models.JobRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body: " + err.Error()})
+		return
+	}
+	enqueueJob(c, h.queue, request.ID, request.Type, request.ForceRefresh)
+}
+
+// GetJob handles GET /jobs/:id. With wait=<duration> it holds the request until the job is done or the wait elapses.
+func (h *JobHandler) GetJob(c *gin.Context) {
+	wait, err := queryDuration(c, "wait", 0, maxJobWait)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.queue.Wait(c.Request.Context(), c.Param("id"), wait)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// enqueueJob validates the indicator, queues its fetch and answers 202 with the job.
+// With refresh the job skips the cache and DB and always asks VirusTotal.
+func enqueueJob(c *gin.Context, queue *jobs.Queue, id, reportType string, refresh bool) {
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id is required"})
+		return
+	}
+	if reportType == "" {
+		var err error
+		if reportType, err = indicator.Detect(id); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+	switch reportType {
+	case "domains", "ip_addresses", "urls", "files":
+	default:
+		respondError(c, services.ErrUnsupportedType)
+		return
+	}
+	id, err := indicator.Normalize(reportType, id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	job, err := queue.Enqueue(c.Request.Context(), reportType, id, refresh)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("Location", "/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryInt reads an integer query parameter within [minValue, maxValue], falling back to def when it is absent
+func queryInt(c *gin.Context, name string, def, minValue, maxValue int) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < minValue || n > maxValue {
+		return 0, fmt.Errorf("%s must be an integer between %d and %d", name, minValue, maxValue)
+	}
+	return n, nil
+}
+
+// queryTime reads an RFC 3339 timestamp or YYYY-MM-DD date query parameter, falling back to def when it is absent
+func queryTime(c *gin.Context, name string, def time.Time) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", name)
+}
+
+// queryEndTime reads an inclusive upper bound like queryTime. A YYYY-MM-DD date covers the whole day,
+// so to=2024-05-01 includes everything on May 1st. Postgres timestamps have microsecond precision.
+func queryEndTime(c *gin.Context, name string, def time.Time) (time.Time, error) {
+	t, err := queryTime(c, name, def)
+	if err != nil || c.Query(name) == "" {
+		return t, err
+	}
+	if _, dateErr := time.Parse(time.DateOnly, c.Query(name)); dateErr == nil {
+		t = t.AddDate(0, 0, 1).Add(-time.Microsecond)
+	}
+	return t, nil
+}
+
+// queryBool reads a true/false query parameter, falling back to def when it is absent
+func queryBool(c *gin.Context, name string, def bool) (bool, error) {
+	value := c.Query(name)
+	if value == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", name)
+	}
+	return b, nil
+}
+
+// queryDuration reads a duration query parameter such as 30s within [0, maxValue], falling back to def when it is absent
+func queryDuration(c *gin.Context, name string, def, maxValue time.Duration) (time.Duration, error) {
+	value := c.Query(name)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 || d > maxValue {
+		return 0, fmt.Errorf("%s must be a duration between 0s and %v", name, maxValue)
+	}
+	return d, nil
+}
+
+// queryOptionalInt reads an integer query parameter within [minValue, maxValue], returning nil when it is absent
+func queryOptionalInt(c *gin.Context, name string, minValue, maxValue int) (*int, error) {
+	if c.Query(name) == "" {
+		return nil, nil
+	}
+	n, err := queryInt(c, name, 0, minValue, maxValue)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// queryOptionalTime reads a timestamp query parameter like queryTime, returning nil when it is absent
+func queryOptionalTime(c *gin.Context, name string) (*time.Time, error) {
+	if c.Query(name) == "" {
+		return nil, nil
+	}
+	t, err := queryTime(c, name, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
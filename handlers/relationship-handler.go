@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+
+	"vt-data-pipeline/indicator"
+	"vt-data-pipeline/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRelationships handles GET /report/:id/relationships/:name?type=...
+// Edges come from the relationships table and are ingested from VirusTotal when missing or older than 24 hours.
+// pages sets how many VT pages an ingest may follow, limit and offset page through the stored edges.
+func (h *ReportHandler) GetRelationships(c *gin.Context) {
+	relation := c.Param("name")
+	reportType := c.Query("type")
+
+	if reportType != "domains" && reportType != "ip_addresses" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "relationships are only supported for domains or ip_addresses"})
+		return
+	}
+	id, err := indicator.Normalize(reportType, c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	pages, err := queryInt(c, "pages", 1, 1, services.MaxRelationshipPages)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, err := queryInt(c, "limit", 100, 1, 1000)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset, err := queryInt(c, "offset", 0, 0, 1<<30)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	edges, err := services.FetchRelationships(id, reportType, relation, pages, limit, offset, h.db, h.redisClient, h.vtClient)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":            id,
+		"type":          reportType,
+		"relation":      relation,
+		"limit":         limit,
+		"offset":        offset,
+		"relationships": edges,
+	})
+}
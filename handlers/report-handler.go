@@ -2,55 +2,183 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
 	"vt-data-pipeline/config"
+	"vt-data-pipeline/indicator"
+	"vt-data-pipeline/jobs"
+	"vt-data-pipeline/models"
 	"vt-data-pipeline/redis"
 	"vt-data-pipeline/services"
+	"vt-data-pipeline/vtclient"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
 
-// ReportHandler handles report requests for domains and IP addresses
+// maxAgeLimit bounds the max_age= override of the freshness policy
+const maxAgeLimit = 30 * 24 * time.Hour
+
+// ReportHandler handles report requests for domains, IP addresses, URLs and files
 type ReportHandler struct {
 	db          *sqlx.DB
 	redisClient *redis.Client
+	vtClient    vtclient.Client
+	queue       *jobs.Queue
 	cfg         *config.Config
 }
 
 // NewReportHandler creates a new ReportHandler instance
-func NewReportHandler(db *sqlx.DB, redisClient *redis.Client, cfg *config.Config) *ReportHandler {
+func NewReportHandler(db *sqlx.DB, redisClient *redis.Client, vtClient vtclient.Client, queue *jobs.Queue, cfg *config.Config) *ReportHandler {
 	return &ReportHandler{
 		db:          db,
 		redisClient: redisClient,
+		vtClient:    vtClient,
+		queue:       queue,
 		cfg:         cfg,
 	}
 }
 
-// GetReport handles the GET request for reports
+// GetReport handles the GET request for reports.
+// The optional include= query parameter picks the report sections to return, e.g. include=analysis_results,details.
+// Without type= the type is detected from the id (hash, IP, URL or domain) and echoed as type and type_inferred.
+// For type=urls the id is the percent-encoded URL, for type=files an MD5, SHA-1 or SHA-256.
+// The id is refanged and canonicalized first, private and reserved IPs are rejected with 400.
+// With async=true the fetch is queued instead and the response is 202 with the job to poll.
+// max_age=<duration> tightens or loosens the freshness policy for this request, force_refresh=true always asks VirusTotal.
+// With stale=true (or STALE_WHILE_REVALIDATE) stale DB data is returned at once with X-Stale: true while a refresh is queued.
+// X-Data-Age always carries the age of the returned data in seconds.
 func (h *ReportHandler) GetReport(c *gin.Context) {
-	id := c.Param("id")
 	reportType := c.Query("type")
 
-	if reportType != "domains" && reportType != "ip_addresses" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "only domains or ip_addresses supported"})
+	// Without type= the type is inferred from the id, an explicit type always wins
+	inferred := reportType == ""
+	if inferred {
+		var err error
+		if reportType, err = indicator.Detect(c.Param("id")); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
+	if reportType != "domains" && reportType != "ip_addresses" && reportType != "urls" && reportType != "files" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "only domains, ip_addresses, urls or files supported"})
 		return
 	}
 
-	var report any
-	var err error
+	// Canonicalize the indicator before it reaches the cache key, the SQL and the VT URL path
+	id, err := indicator.Normalize(reportType, c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	opts, err := h.fetchOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	async, err := queryBool(c, "async", false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if async {
+		enqueueJob(c, h.queue, id, reportType, opts.ForceRefresh)
+		return
+	}
+
+	serveStale, err := queryBool(c, "stale", h.cfg.Freshness.StaleWhileRevalidate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if serveStale {
+		opts.Revalidate = h.queue
+	}
+
+	var report, fetched any
 
 	switch reportType {
 	case "domains":
-		report, err = services.FetchDomainVTReport(id, reportType, h.db, h.redisClient, h.cfg)
+		sections, parseErr := models.ParseReportSections(c.Query("include"), models.DomainSections...)
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": parseErr.Error()})
+			return
+		}
+		var domainReport *models.DomainReport
+		domainReport, err = services.FetchDomainVTReport(id, reportType, h.db, h.redisClient, h.vtClient, opts)
+		if err == nil {
+			selected := domainReport.Select(sections)
+			selected.Type, selected.TypeInferred = reportType, inferred
+			report, fetched = selected, domainReport
+		}
 	case "ip_addresses":
-		report, err = services.FetchIPReport(id, reportType, h.db, h.redisClient, h.cfg)
+		sections, parseErr := models.ParseReportSections(c.Query("include"), models.IPSections...)
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": parseErr.Error()})
+			return
+		}
+		var ipReport *models.IPReport
+		ipReport, err = services.FetchIPReport(id, reportType, h.db, h.redisClient, h.vtClient, opts)
+		if err == nil {
+			selected := ipReport.Select(sections)
+			selected.Type, selected.TypeInferred = reportType, inferred
+			report, fetched = selected, ipReport
+		}
+	case "urls":
+		sections, parseErr := models.ParseReportSections(c.Query("include"), models.URLSections...)
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": parseErr.Error()})
+			return
+		}
+		var urlReport *models.URLReport
+		urlReport, err = services.FetchURLReport(id, reportType, h.db, h.redisClient, h.vtClient, opts)
+		if err == nil {
+			selected := urlReport.Select(sections)
+			selected.Type, selected.TypeInferred = reportType, inferred
+			report, fetched = selected, urlReport
+		}
+	case "files":
+		sections, parseErr := models.ParseReportSections(c.Query("include"), models.FileSections...)
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": parseErr.Error()})
+			return
+		}
+		var fileReport *models.FileReport
+		fileReport, err = services.FetchFileReport(id, reportType, h.db, h.redisClient, h.vtClient, opts)
+		if err == nil {
+			selected := fileReport.Select(sections)
+			selected.Type, selected.TypeInferred = reportType, inferred
+			report, fetched = selected, fileReport
+		}
 	}
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
+	age, stale := opts.Staleness(reportType, fetched)
+	c.Header("X-Data-Age", strconv.Itoa(int(age.Seconds())))
+	if stale {
+		c.Header("X-Stale", "true")
+	}
+
 	c.JSON(http.StatusOK, report)
 }
+
+// fetchOptions reads the max_age= and force_refresh= overrides of the configured freshness policy
+func (h *ReportHandler) fetchOptions(c *gin.Context) (services.FetchOptions, error) {
+	opts := services.FetchOptions{Freshness: h.cfg.Freshness}
+	var err error
+	if opts.MaxAge, err = queryDuration(c, "max_age", 0, maxAgeLimit); err != nil {
+		return opts, err
+	}
+	if opts.ForceRefresh, err = queryBool(c, "force_refresh", false); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"vt-data-pipeline/indicator"
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// SearchHandler searches the stored indicators
+type SearchHandler struct {
+	db *sqlx.DB
+}
+
+// NewSearchHandler creates a new SearchHandler instance
+func NewSearchHandler(db *sqlx.DB) *SearchHandler {
+	return &SearchHandler{
+		db: db,
+	}
+}
+
+// SearchIPs handles GET /ips?cidr=&asn=&country=&min_malicious=&sort=&limit=&offset=.
+// Only stored IPs are searched, VirusTotal is never called.
+func (h *SearchHandler) SearchIPs(c *gin.Context) {
+	search := models.IPSearch{
+		Country: strings.ToUpper(c.Query("country")),
+		Sort:    c.DefaultQuery("sort", "-last_analysis_date"),
+	}
+	if search.Country != "" && len(search.Country) != 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "country must be a two-letter country code"})
+		return
+	}
+
+	if value := c.Query("cidr"); value != "" {
+		cidr, err := queryCIDR(value)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		search.CIDR = &cidr
+	}
+
+	var err error
+	if search.ASN, err = queryOptionalInt(c, "asn", 0, 1<<31-1); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if search.MinMalicious, err = queryOptionalInt(c, "min_malicious", 0, 1000); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if search.Limit, err = queryInt(c, "limit", 100, 1, 1000); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if search.Offset, err = queryInt(c, "offset", 0, 0, 1<<30); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ips, err := services.SearchIPs(search, h.db)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ips": ips, "sort": search.Sort, "limit": search.Limit, "offset": search.Offset})
+}
+
+// maxSearchWindow bounds created_within and expires_within
+const maxSearchWindow = 10 * 365 * 24 * time.Hour
+
+// SearchDomains handles GET /domains?tld=&registrar=&created_after=&created_before=&created_within=
+// &expires_after=&expires_before=&expires_within=&min_reputation=&max_reputation=&min_malicious=
+// &category=&whois=&sort=&limit=&cursor=. Only stored domains are searched, VirusTotal is never called.
+func (h *SearchHandler) SearchDomains(c *gin.Context) {
+	search := models.DomainSearch{
+		TLD:       strings.ToLower(strings.TrimPrefix(c.Query("tld"), ".")),
+		Registrar: c.Query("registrar"),
+		Category:  c.Query("category"),
+		Whois:     c.Query("whois"),
+		Sort:      c.DefaultQuery("sort", "-creation_date"),
+	}
+
+	var err error
+	if search.CreatedAfter, search.CreatedBefore, err = queryWindow(c, "created", -1); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if search.ExpiresAfter, search.ExpiresBefore, err = queryWindow(c, "expires", 1); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if search.MinReputation, err = queryOptionalInt(c, "min_reputation", -1<<31, 1<<31-1); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if search.MaxReputation, err = queryOptionalInt(c, "max_reputation", -1<<31, 1<<31-1); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if search.MinMalicious, err = queryOptionalInt(c, "min_malicious", 0, 1000); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if search.Limit, err = queryInt(c, "limit", 100, 1, 1000); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	domains, next, err := services.SearchDomains(search, c.Query("cursor"), h.db)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	response := gin.H{"domains": domains, "sort": search.Sort, "limit": search.Limit}
+	if next != "" {
+		response["next_cursor"] = next
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// queryWindow reads <prefix>_after, <prefix>_before and <prefix>_within. The window runs from now
+// into the past (direction -1, e.g. newly registered) or into the future (direction 1, e.g. expiring soon).
+func queryWindow(c *gin.Context, prefix string, direction int) (after, before *time.Time, err error) {
+	if after, err = queryOptionalTime(c, prefix+"_after"); err != nil {
+		return nil, nil, err
+	}
+	if before, err = queryOptionalTime(c, prefix+"_before"); err != nil {
+		return nil, nil, err
+	}
+	within, err := queryDuration(c, prefix+"_within", 0, maxSearchWindow)
+	if err != nil || within == 0 {
+		return after, before, err
+	}
+	if after != nil || before != nil {
+		return nil, nil, fmt.Errorf("%s_within cannot be combined with %s_after or %s_before", prefix, prefix, prefix)
+	}
+	now := time.Now()
+	from, to := now.Add(-within), now
+	if direction > 0 {
+		from, to = now, now.Add(within)
+	}
+	return &from, &to, nil
+}
+
+// queryCIDR parses a CIDR network, a single IP address is searched as a /32 or /128
+func queryCIDR(value string) (netip.Prefix, error) {
+	if !strings.Contains(value, "/") {
+		if addr, err := netip.ParseAddr(indicator.Refang(value)); err == nil {
+			addr = addr.Unmap()
+			return netip.PrefixFrom(addr, addr.BitLen()), nil
+		}
+	}
+	return indicator.Network(value)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"vt-data-pipeline/config"
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// WatchlistHandler manages the indicators refreshed on a schedule
+type WatchlistHandler struct {
+	db  *sqlx.DB
+	cfg *config.Config
+}
+
+// NewWatchlistHandler creates a new WatchlistHandler instance
+func NewWatchlistHandler(db *sqlx.DB, cfg *config.Config) *WatchlistHandler {
+	return &WatchlistHandler{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// GetWatchlist handles GET /watchlist
+func (h *WatchlistHandler) GetWatchlist(c *gin.Context) {
+	entries, err := services.GetWatchlist(h.db)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// AddToWatchlist handles POST /watchlist with a body of {"id": ..., "type": ..., "interval": "6h"}.
+// Posting an already watched indicator updates its interval.
+func (h *WatchlistHandler) AddToWatchlist(c *gin.Context) {
+	var request models.WatchlistRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body: " + err.Error()})
+		return
+	}
+
+	interval := h.cfg.Watchlist.DefaultInterval
+	if request.Interval != "" {
+		var err error
+		if interval, err = time.ParseDuration(request.Interval); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be a duration such as 6h"})
+			return
+		}
+	}
+
+	entry, err := services.AddToWatchlist(request.ID, request.Type, interval, h.db)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, entry)
+}
+
+// RemoveFromWatchlist handles DELETE /watchlist/:id?type=...
+func (h *WatchlistHandler) RemoveFromWatchlist(c *gin.Context) {
+	if err := services.RemoveFromWatchlist(c.Param("id"), c.Query("type"), h.db); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
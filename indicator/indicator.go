@@ -0,0 +1,254 @@
+package indicator
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	// ErrInvalid is wrapped by every validation error of this package
+	ErrInvalid = errors.New("invalid indicator")
+	// ErrInvalidHash is returned for file ids that are not an MD5, SHA-1 or SHA-256 hex digest
+	ErrInvalidHash = fmt.Errorf("%w: file id must be an MD5, SHA-1 or SHA-256 hex digest", ErrInvalid)
+	// ErrReservedIP is returned for private, loopback, link-local, documentation and other non-public addresses
+	ErrReservedIP = fmt.Errorf("%w: private or reserved IP addresses are not looked up", ErrInvalid)
+)
+
+// reservedPrefixes are special-purpose ranges that netip does not classify as private or non-global
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "This network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // TEST-NET-1
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // TEST-NET-2
+	netip.MustParsePrefix("203.0.113.0/24"),  // TEST-NET-3
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved for future use
+	netip.MustParsePrefix("100::/64"),        // Discard-only
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+}
+
+// domainProfile maps and validates names like DNS lookups do, but allows the underscores seen in real subdomains
+var domainProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
+var (
+	defangedDot    = regexp.MustCompile(`(?i)\[\.\]|\(\.\)|\{\.\}|\[dot\]|\(dot\)|\{dot\}|\\\.`)
+	defangedColon  = regexp.MustCompile(`\[:\]`)
+	defangedSlash  = regexp.MustCompile(`\[/\]`)
+	defangedScheme = regexp.MustCompile(`(?i)^(?:hxxp|h\*\*p|hxp)(s?)://`)
+	defangedFTP    = regexp.MustCompile(`(?i)^fxp://`)
+)
+
+// Refang undoes the usual defanging of indicators copied from reports and tickets,
+// e.g. example[.]com, 1.2.3[.]4 and hxxps[://]example(.)com
+func Refang(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.ReplaceAll(s, "[://]", "://")
+	s = defangedDot.ReplaceAllString(s, ".")
+	s = defangedColon.ReplaceAllString(s, ":")
+	s = defangedSlash.ReplaceAllString(s, "/")
+	s = defangedScheme.ReplaceAllString(s, "http$1://")
+	s = defangedFTP.ReplaceAllString(s, "ftp://")
+	return s
+}
+
+// Host returns the host of a pasted URL, host:port or [IPv6]:port, or s itself
+func Host(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+	}
+	if i := strings.IndexAny(s, "/?#"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		s = s[i+1:]
+	}
+	if strings.HasPrefix(s, "[") {
+		if i := strings.Index(s, "]"); i > 0 {
+			return s[1:i]
+		}
+	}
+	// A single colon separates a port, IPv6 addresses always have at least two
+	if strings.Count(s, ":") == 1 {
+		s = s[:strings.Index(s, ":")]
+	}
+	return s
+}
+
+// Normalize validates an indicator of a report type and returns its canonical form
+func Normalize(reportType, s string) (string, error) {
+	switch reportType {
+	case "domains":
+		return Domain(s)
+	case "ip_addresses":
+		return IP(s)
+	case "urls":
+		return URL(s)
+	case "files":
+		return Hash(s)
+	}
+	return "", fmt.Errorf("%w: unknown type %q", ErrInvalid, reportType)
+}
+
+// Detect infers the report type of an indicator: files for MD5, SHA-1 and SHA-256 digests,
+// ip_addresses for IP addresses, urls for anything with a scheme, path or query, and domains otherwise
+func Detect(s string) (string, error) {
+	s = Refang(s)
+	if s == "" {
+		return "", fmt.Errorf("%w: indicator is empty", ErrInvalid)
+	}
+	if _, err := Hash(s); err == nil {
+		return "files", nil
+	}
+	if _, err := netip.ParsePrefix(s); err == nil {
+		return "", fmt.Errorf("%w: %s is a network range, not an indicator", ErrInvalid, s)
+	}
+	if strings.Contains(s, "://") || strings.ContainsAny(strings.TrimRight(s, "/"), "/?#") {
+		return "urls", nil
+	}
+	if _, err := netip.ParseAddr(Host(s)); err == nil {
+		return "ip_addresses", nil
+	}
+	return "domains", nil
+}
+
+// Domain returns the canonical form of a domain: refanged, taken from a pasted URL if needed,
+// lowercased, without trailing dot and with internationalized labels converted to punycode
+func Domain(s string) (string, error) {
+	host := strings.TrimRight(Host(Refang(s)), ".")
+	if host == "" {
+		return "", fmt.Errorf("%w: domain is empty", ErrInvalid)
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return "", fmt.Errorf("%w: %s is an IP address, use type=ip_addresses", ErrInvalid, host)
+	}
+
+	domain, err := domainProfile.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q is not a valid domain name", ErrInvalid, s)
+	}
+	domain = strings.ToLower(domain)
+	if len(domain) > 253 || !strings.Contains(domain, ".") {
+		return "", fmt.Errorf("%w: %q is not a valid domain name", ErrInvalid, s)
+	}
+	labels := strings.Split(domain, ".")
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || strings.Trim(label, "abcdefghijklmnopqrstuvwxyz0123456789-_") != "" {
+			return "", fmt.Errorf("%w: %q is not a valid domain name", ErrInvalid, s)
+		}
+	}
+	if strings.Trim(labels[len(labels)-1], "0123456789") == "" {
+		return "", fmt.Errorf("%w: %q has a numeric top-level domain", ErrInvalid, s)
+	}
+	return domain, nil
+}
+
+// IP returns the canonical form of a public IP address. IPv4-mapped IPv6 addresses become IPv4,
+// IPv6 addresses are compressed and lowercased.
+func IP(s string) (string, error) {
+	host := Host(Refang(s))
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q is not a valid IP address", ErrInvalid, s)
+	}
+	if addr.Zone() != "" {
+		return "", fmt.Errorf("%w: %q has an IPv6 zone", ErrInvalid, s)
+	}
+	addr = addr.Unmap()
+	if IsReserved(addr) {
+		return "", fmt.Errorf("%w: %s", ErrReservedIP, addr)
+	}
+	return addr.String(), nil
+}
+
+// Addr returns the canonical form of any IP address, reserved ones included, or s unchanged if it is not one.
+// Used for addresses VirusTotal returns, which are stored as they are but must match canonical IDs.
+func Addr(s string) string {
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil || addr.Zone() != "" {
+		return s
+	}
+	return addr.Unmap().String()
+}
+
+// Network parses a CIDR network and returns it masked to its prefix length,
+// with IPv4-mapped IPv6 networks converted to IPv4 (e.g. ::ffff:1.2.3.0/120 becomes 1.2.3.0/24)
+func Network(s string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(Refang(s)))
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%w: %q is not a valid CIDR network", ErrInvalid, s)
+	}
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), nil
+}
+
+// IsReserved reports whether addr is not a public unicast address
+func IsReserved(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return true
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// URL returns the canonical form of a URL: refanged, http:// added when the scheme is missing,
+// scheme and host lowercased and the host normalized like a domain or IP. Path and query are kept as they are.
+func URL(s string) (string, error) {
+	s = Refang(s)
+	if s == "" {
+		return "", fmt.Errorf("%w: URL is empty", ErrInvalid)
+	}
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("%w: %q is not a valid URL", ErrInvalid, s)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host := u.Hostname()
+	if _, err := netip.ParseAddr(host); err == nil {
+		if host, err = IP(host); err != nil {
+			return "", err
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+	} else if host, err = Domain(host); err != nil {
+		return "", err
+	}
+	if port := u.Port(); port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+	return u.String(), nil
+}
+
+// Hash returns a file hash lowercased after checking that it is a 32, 40 or 64 character hex digest
+func Hash(s string) (string, error) {
+	hash := strings.ToLower(strings.TrimSpace(s))
+	if len(hash) != 32 && len(hash) != 40 && len(hash) != 64 {
+		return "", ErrInvalidHash
+	}
+	for _, r := range hash {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return "", ErrInvalidHash
+		}
+	}
+	return hash, nil
+}
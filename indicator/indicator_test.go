@@ -0,0 +1,224 @@
+package indicator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRefang(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"example[.]com", "example.com"},
+		{"1.2.3[.]4", "1.2.3.4"},
+		{"hxxps[://]example(.)com", "https://example.com"},
+		{"hxxp://example{dot}com/a[/]b", "http://example.com/a/b"},
+		{"fxp://files[.]example[.]com", "ftp://files.example.com"},
+		{"  example.com  ", "example.com"},
+	}
+	for _, tt := range tests {
+		if got := Refang(tt.in); got != tt.want {
+			t.Errorf("Refang(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDomain(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "example[.]com", want: "example.com"},
+		{in: "Example.COM.", want: "example.com"},
+		{in: "hxxps[://]www.example[.]com/path?q=1", want: "www.example.com"},
+		{in: "example.com:8443", want: "example.com"},
+		{in: "bücher.de", want: "xn--bcher-kva.de"},
+		{in: "_dmarc.example.com", want: "_dmarc.example.com"},
+		{in: "localhost", wantErr: true},
+		{in: "1.2.3.4", wantErr: true},
+		{in: "example.123", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Domain(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Domain(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr && !errors.Is(err, ErrInvalid) {
+			t.Errorf("Domain(%q) error = %v, want ErrInvalid", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("Domain(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIP(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  error
+	}{
+		{in: "8.8.8.8", want: "8.8.8.8"},
+		{in: "8.8.8[.]8", want: "8.8.8.8"},
+		{in: "::ffff:1.2.3.4", want: "1.2.3.4"},
+		{in: "2001:4860:4860:0000:0000:0000:0000:8888", want: "2001:4860:4860::8888"},
+		{in: "8.8.8.8:53", want: "8.8.8.8"},
+		{in: "[2001:4860:4860::8888]:443", want: "2001:4860:4860::8888"},
+		{in: "10.0.0.1", wantErr: ErrReservedIP},
+		{in: "127.0.0.1", wantErr: ErrReservedIP},
+		{in: "100.64.0.1", wantErr: ErrReservedIP},
+		{in: "::ffff:192.168.1.1", wantErr: ErrReservedIP},
+		{in: "2001:db8::1", wantErr: ErrReservedIP},
+		{in: "fe80::1%eth0", wantErr: ErrInvalid},
+		{in: "example.com", wantErr: ErrInvalid},
+	}
+	for _, tt := range tests {
+		got, err := IP(tt.in)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("IP(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("IP(%q) unexpected error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("IP(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHost(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"example.com", "example.com"},
+		{"example.com:8080", "example.com"},
+		{"https://user@example.com:8443/path#frag", "example.com"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"2001:db8::1", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		if got := Host(tt.in); got != tt.want {
+			t.Errorf("Host(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "hxxps[://]Example[.]com/Path?q=1", want: "https://example.com/Path?q=1"},
+		{in: "example.com/login", want: "http://example.com/login"},
+		{in: "http://bücher.de:8080/", want: "http://xn--bcher-kva.de:8080/"},
+		{in: "http://[2001:4860:4860:0:0:0:0:8888]:443/", want: "http://[2001:4860:4860::8888]:443/"},
+		{in: "http://10.0.0.1/admin", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := URL(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("URL(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("URL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "44D88612FEA8A8F36DE82E1278ABB02F", want: "44d88612fea8a8f36de82e1278abb02f"},
+		{in: "3395856ce81f2b7382dee72602f798b642f14140", want: "3395856ce81f2b7382dee72602f798b642f14140"},
+		{in: "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f", want: "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f"},
+		{in: "44d88612fea8a8f36de82e1278abb02", wantErr: true},
+		{in: "zzd88612fea8a8f36de82e1278abb02f", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Hash(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Hash(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr && !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("Hash(%q) error = %v, want ErrInvalidHash", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("Hash(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "44d88612fea8a8f36de82e1278abb02f", want: "files"},
+		{in: "8.8.8[.]8", want: "ip_addresses"},
+		{in: "[2001:4860:4860::8888]:443", want: "ip_addresses"},
+		{in: "example[.]com", want: "domains"},
+		{in: "example.com:8080", want: "domains"},
+		{in: "hxxps[://]example[.]com", want: "urls"},
+		{in: "example.com/login", want: "urls"},
+		{in: "10.0.0.0/8", wantErr: true},
+		{in: " ", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Detect(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Detect(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Detect(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"10.1.2.3/8", "10.0.0.0/8"},
+		{"::ffff:1.2.3.0/120", "1.2.3.0/24"},
+		{"2001:DB8::1/32", "2001:db8::/32"},
+		{"2001:4860:4860::8888/48", "2001:4860:4860::/48"},
+	}
+	for _, tt := range tests {
+		got, err := Network(tt.in)
+		if err != nil {
+			t.Errorf("Network(%q) unexpected error: %v", tt.in, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("Network(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAddr(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"10.0.0.1", "10.0.0.1"},
+		{"::ffff:10.0.0.1", "10.0.0.1"},
+		{"2001:DB8:0:0:0:0:0:1", "2001:db8::1"},
+		{"fe80::1%eth0", "fe80::1%eth0"},
+		{"not an ip", "not an ip"},
+	}
+	for _, tt := range tests {
+		if got := Addr(tt.in); got != tt.want {
+			t.Errorf("Addr(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
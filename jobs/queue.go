@@ -0,0 +1,485 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/ratelimit"
+	"vt-data-pipeline/redis"
+)
+
+const (
+	streamKey = "jobs:fetch"
+	groupName = "fetchers"
+	// deadLetterKey collects poison entries: jobs that ran out of attempts and entries that cannot be processed.
+	// It keeps about the last deadLetterMaxLen of them.
+	deadLetterKey    = "jobs:fetch:dead"
+	deadLetterMaxLen = 10000
+	// delayedKey holds the IDs of jobs waiting for a retry, scored by their RetryAt in Unix milliseconds.
+	// They are off the stream until due, then appended to it again by promoteDue.
+	delayedKey = "jobs:fetch:delayed"
+	// promoteBatch is how many due jobs one promoteDue call moves back to the stream
+	promoteBatch = 100
+	jobKeyPrefix = "job:"
+	// inflightKeyPrefix maps an indicator to the job that is fetching it, see EnqueueOnce
+	inflightKeyPrefix = "jobs:inflight:"
+	// jobTTL is how long a job and its result stay available for polling.
+	// It also bounds the age of a job: one still not done after jobTTL fails, so quota waits cannot retry forever.
+	jobTTL = 24 * time.Hour
+	// claimIdle is how long an entry stays pending before another delivery is attempted.
+	// It covers jobs left behind by a consumer that died mid-fetch; a running job is kept
+	// from being claimed by a heartbeat every heartbeatInterval.
+	claimIdle         = time.Minute
+	heartbeatInterval = claimIdle / 3
+	// jobTimeout bounds one run of a job. Runs are detached from shutdown, so this is also
+	// how long a stopping consumer may take to finish its current job.
+	jobTimeout = 5 * time.Minute
+	// maxRetryDelay caps the exponential backoff between attempts
+	maxRetryDelay = time.Hour
+	readBlock     = 5 * time.Second
+	pollInterval  = 250 * time.Millisecond
+)
+
+// promoteScript moves the due jobs of the delayed set back to the stream. Only the caller that removes
+// a job from the set appends it, so several consumers promoting at once do not duplicate it.
+const promoteScript = `
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(due) do
+  if redis.call('ZREM', KEYS[1], id) == 1 then
+    redis.call('XADD', KEYS[2], '*', 'job_id', id)
+  end
+end
+return #due
+`
+
+// ErrJobNotFound is returned for unknown or expired job IDs
+var ErrJobNotFound = errors.New("job not found or expired")
+
+// PermanentError marks a job failure that retrying cannot fix, e.g. an indicator unknown to VirusTotal
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Permanent wraps err so that the queue fails the job instead of retrying it
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+// Handler runs a job and returns the value stored as its result
+type Handler func(ctx context.Context, job *models.Job) (any, error)
+
+// Queue is a durable fetch queue on a Redis stream.
+// Entries are read through a consumer group and only acknowledged once the job succeeded or failed for good,
+// so jobs survive restarts and are retried with backoff on transient errors.
+// Any number of consumers, in the API server or in worker processes, can share the group.
+type Queue struct {
+	redisClient *redis.Client
+	maxAttempts int
+	retryDelay  time.Duration
+}
+
+// NewQueue creates a new Queue instance
+func NewQueue(redisClient *redis.Client, maxAttempts int, retryDelay time.Duration) *Queue {
+	return &Queue{
+		redisClient: redisClient,
+		maxAttempts: maxAttempts,
+		retryDelay:  retryDelay,
+	}
+}
+
+// Enqueue records a new job and appends it to the stream
+func (q *Queue) Enqueue(ctx context.Context, reportType, indicator string, refresh bool) (*models.Job, error) {
+	return q.enqueue(ctx, &models.Job{Type: reportType, Indicator: indicator, Refresh: refresh})
+}
+
+// EnqueueScheduled queues a refresh job on behalf of the watchlist scheduler
+func (q *Queue) EnqueueScheduled(ctx context.Context, reportType, indicator string) (*models.Job, error) {
+	return q.enqueue(ctx, &models.Job{Type: reportType, Indicator: indicator, Refresh: true, Scheduled: true})
+}
+
+// EnqueueOnce returns the unfinished job queued earlier for the same indicator and refresh flag,
+// and only queues a new job when there is none. Clients polling the same lookup then share one job and one VT call.
+func (q *Queue) EnqueueOnce(ctx context.Context, reportType, indicator string, refresh bool) (*models.Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	key := inflightKeyPrefix + reportType + ":" + indicator
+	if refresh {
+		key += ":refresh"
+	}
+	acquired, err := q.redisClient.SetNX(ctx, key, id, jobTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		if existingID, err := q.redisClient.Get(ctx, key); err == nil {
+			if job, err := q.Get(ctx, existingID); err == nil && !job.Done() {
+				log.Printf("Reusing job %s for ID: %s, Type: %s", job.ID, indicator, reportType)
+				return job, nil
+			}
+		}
+		// The earlier job is done or gone, this one takes its place
+		if err := q.redisClient.Set(ctx, key, id, jobTTL); err != nil {
+			return nil, err
+		}
+	}
+
+	job, err := q.enqueue(ctx, &models.Job{ID: id, Type: reportType, Indicator: indicator, Refresh: refresh})
+	if err != nil {
+		q.redisClient.Delete(ctx, key)
+		return nil, err
+	}
+	return job, nil
+}
+
+// enqueue saves a job and appends it to the stream. A new ID is generated unless the job already has one.
+func (q *Queue) enqueue(ctx context.Context, job *models.Job) (*models.Job, error) {
+	if job.ID == "" {
+		id, err := newJobID()
+		if err != nil {
+			return nil, err
+		}
+		job.ID = id
+	}
+	now := time.Now()
+	job.Status = models.JobQueued
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	if err := q.save(ctx, job); err != nil {
+		return nil, err
+	}
+	if _, err := q.redisClient.XAdd(ctx, streamKey, map[string]interface{}{"job_id": job.ID}); err != nil {
+		log.Printf("Error adding job %s to stream: %v", job.ID, err)
+		return nil, err
+	}
+	log.Printf("Enqueued job %s for ID: %s, Type: %s", job.ID, job.Indicator, job.Type)
+	return job, nil
+}
+
+// Get returns the current state of a job
+func (q *Queue) Get(ctx context.Context, id string) (*models.Job, error) {
+	data, err := q.redisClient.Get(ctx, jobKeyPrefix+id)
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job models.Job
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Wait polls a job until it is done or timeout elapses, and returns its latest state
+func (q *Queue) Wait(ctx context.Context, id string, timeout time.Duration) (*models.Job, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		job, err := q.Get(ctx, id)
+		if err != nil || job.Done() || time.Now().After(deadline) {
+			return job, err
+		}
+		select {
+		case <-ctx.Done():
+			return job, nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// RunWorkers runs concurrency consumers named <consumer>-<n> until ctx is cancelled and they have finished their current job
+func (q *Queue) RunWorkers(ctx context.Context, consumer string, concurrency int, handler Handler) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, concurrency)
+	for i := range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- q.Run(ctx, fmt.Sprintf("%s-%d", consumer, i+1), handler)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run consumes the stream as the given consumer until ctx is cancelled.
+// Due retries and entries abandoned by other consumers are claimed before new entries are read.
+// Cancelling ctx only stops reading: a job already running finishes and records its outcome.
+func (q *Queue) Run(ctx context.Context, consumer string, handler Handler) error {
+	if err := q.redisClient.XGroupCreate(ctx, streamKey, groupName); err != nil {
+		return err
+	}
+	log.Printf("Job consumer %s started", consumer)
+
+	for ctx.Err() == nil {
+		q.promoteDue(ctx)
+		messages, err := q.redisClient.XAutoClaim(ctx, streamKey, groupName, consumer, claimIdle, 1)
+		if err == nil && len(messages) == 0 {
+			messages, err = q.redisClient.XReadGroup(ctx, streamKey, groupName, consumer, 1, readBlock)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("Error reading job stream: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, message := range messages {
+			q.process(ctx, consumer, message, handler)
+		}
+	}
+	log.Printf("Job consumer %s stopped", consumer)
+	return ctx.Err()
+}
+
+// process runs one stream entry.
+// Finished jobs are acked, jobs to retry are nacked by leaving them pending so they are claimed again later,
+// and poison entries are moved to the dead-letter stream.
+// The entry is processed on a context detached from consumerCtx, so a shutdown does not cut a job short.
+func (q *Queue) process(consumerCtx context.Context, consumer string, message redis.StreamMessage, handler Handler) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(consumerCtx), jobTimeout)
+	defer cancel()
+
+	jobID, _ := message.Values["job_id"].(string)
+	job, err := q.Get(ctx, jobID)
+	if errors.Is(err, ErrJobNotFound) {
+		q.deadLetter(ctx, message.ID, jobID, 0, "job no longer exists")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading job %s: %v", jobID, err)
+		return
+	}
+	if job.Done() {
+		q.ack(ctx, message.ID)
+		return
+	}
+	if time.Since(job.CreatedAt) > jobTTL {
+		reason := fmt.Sprintf("job expired after %v without completing", jobTTL)
+		if job.Error != "" {
+			reason += ", last error: " + job.Error
+		}
+		q.fail(ctx, message.ID, job, errors.New(reason), false)
+		return
+	}
+	if job.RetryAt != nil && time.Now().Before(*job.RetryAt) {
+		// Only reached when deferring the retry failed earlier and the entry was claimed again
+		q.deferRetry(ctx, message.ID, job)
+		return
+	}
+	if job.Attempts >= q.maxAttempts {
+		// The last attempt never recorded an outcome, so the consumer running it died.
+		// Do not let a job that keeps crashing consumers be retried forever.
+		q.fail(ctx, message.ID, job, errors.New("no attempt completed, consumer stopped while running the job"), true)
+		return
+	}
+
+	job.Status = models.JobRunning
+	job.Attempts++
+	job.RetryAt = nil
+	job.UpdatedAt = time.Now()
+	if err := q.save(ctx, job); err != nil {
+		log.Printf("Error saving job %s: %v", job.ID, err)
+		return
+	}
+
+	stopHeartbeat := q.heartbeat(ctx, consumer, message.ID)
+	result, err := handler(ctx, job)
+	stopHeartbeat()
+	if err == nil {
+		job.Result, err = json.Marshal(result)
+	}
+
+	var permanent *PermanentError
+	var quotaErr *ratelimit.QuotaExhaustedError
+	switch {
+	case err == nil:
+		now := time.Now()
+		job.Status = models.JobSucceeded
+		job.Error = ""
+		job.UpdatedAt = now
+		job.FinishedAt = &now
+		if err := q.save(ctx, job); err != nil {
+			log.Printf("Error saving job %s: %v", job.ID, err)
+			return
+		}
+		log.Printf("Job %s succeeded after %d attempt(s)", job.ID, job.Attempts)
+		q.ack(ctx, message.ID)
+	case errors.As(err, &permanent):
+		q.fail(ctx, message.ID, job, err, false)
+	case job.Attempts >= q.maxAttempts && !errors.As(err, &quotaErr):
+		q.fail(ctx, message.ID, job, err, true)
+	default:
+		delay := q.backoff(job.Attempts)
+		if errors.As(err, &quotaErr) {
+			// Waiting for quota is not a failed attempt, but the job may only wait until it expires
+			job.Attempts--
+			delay = max(delay, quotaErr.RetryAfter)
+			if time.Since(job.CreatedAt)+delay > jobTTL {
+				q.fail(ctx, message.ID, job, fmt.Errorf("VirusTotal quota not available within %v: %w", jobTTL, err), false)
+				return
+			}
+		}
+		q.nack(ctx, message.ID, job, err, delay)
+	}
+}
+
+// heartbeat keeps claiming the entry for consumer until the returned function is called,
+// so a job running longer than claimIdle is not claimed and run again by another consumer
+func (q *Queue) heartbeat(ctx context.Context, consumer, messageID string) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := q.redisClient.XClaimJustID(ctx, streamKey, groupName, consumer, messageID); err != nil {
+					log.Printf("Error extending stream entry %s: %v", messageID, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// fail marks a job failed and acks its entry, moving it to the dead-letter stream when it is poison
+func (q *Queue) fail(ctx context.Context, messageID string, job *models.Job, err error, poison bool) {
+	now := time.Now()
+	job.Status = models.JobFailed
+	job.Error = err.Error()
+	job.UpdatedAt = now
+	job.FinishedAt = &now
+	if err := q.save(ctx, job); err != nil {
+		log.Printf("Error saving job %s: %v", job.ID, err)
+		return
+	}
+	log.Printf("Job %s failed after %d attempt(s): %v", job.ID, job.Attempts, err)
+
+	if poison {
+		q.deadLetter(ctx, messageID, job.ID, job.Attempts, err.Error())
+		return
+	}
+	q.ack(ctx, messageID)
+}
+
+// nack records a transient failure and defers the job until retryAt has passed
+func (q *Queue) nack(ctx context.Context, messageID string, job *models.Job, err error, delay time.Duration) {
+	retryAt := time.Now().Add(delay)
+	job.Status = models.JobRetrying
+	job.Error = err.Error()
+	job.RetryAt = &retryAt
+	job.UpdatedAt = time.Now()
+	if err := q.save(ctx, job); err != nil {
+		log.Printf("Error saving job %s: %v", job.ID, err)
+		return
+	}
+	log.Printf("Job %s will be retried at %v: %v", job.ID, retryAt, err)
+	q.deferRetry(ctx, messageID, job)
+}
+
+// deferRetry takes the entry of a job waiting for its retry off the stream and puts the job in the delayed set,
+// so it is not claimed over and over before RetryAt. If that fails the entry stays pending and is claimed again.
+func (q *Queue) deferRetry(ctx context.Context, messageID string, job *models.Job) {
+	if err := q.redisClient.ZAdd(ctx, delayedKey, float64(job.RetryAt.UnixMilli()), job.ID); err != nil {
+		log.Printf("Error deferring job %s: %v", job.ID, err)
+		return
+	}
+	q.ack(ctx, messageID)
+}
+
+// promoteDue appends the jobs whose retry is due back to the stream
+func (q *Queue) promoteDue(ctx context.Context) {
+	promoted, err := q.redisClient.Eval(ctx, promoteScript, []string{delayedKey, streamKey}, time.Now().UnixMilli(), promoteBatch)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Error promoting delayed jobs: %v", err)
+		}
+		return
+	}
+	if n, ok := promoted.(int64); ok && n > 0 {
+		log.Printf("Moved %d delayed job(s) back to the stream", n)
+	}
+}
+
+// deadLetter copies an entry to the dead-letter stream and acks it. If the copy fails the entry stays pending.
+func (q *Queue) deadLetter(ctx context.Context, messageID, jobID string, attempts int, reason string) {
+	_, err := q.redisClient.XAddCapped(ctx, deadLetterKey, deadLetterMaxLen, map[string]interface{}{
+		"entry_id":  messageID,
+		"job_id":    jobID,
+		"attempts":  attempts,
+		"reason":    reason,
+		"failed_at": time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Printf("Error moving stream entry %s to the dead-letter stream: %v", messageID, err)
+		return
+	}
+	log.Printf("Moved stream entry %s (job %q) to the dead-letter stream: %s", messageID, jobID, reason)
+	q.ack(ctx, messageID)
+}
+
+// backoff doubles the retry delay with every attempt, up to maxRetryDelay
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+func (q *Queue) save(ctx context.Context, job *models.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return q.redisClient.Set(ctx, jobKeyPrefix+job.ID, data, jobTTL)
+}
+
+// ack acknowledges an entry and deletes it, so the stream only holds entries that are still queued or pending
+func (q *Queue) ack(ctx context.Context, messageID string) {
+	if err := q.redisClient.XAck(ctx, streamKey, groupName, messageID); err != nil {
+		log.Printf("Error acknowledging stream entry %s: %v", messageID, err)
+		return
+	}
+	if err := q.redisClient.XDel(ctx, streamKey, messageID); err != nil {
+		log.Printf("Error deleting stream entry %s: %v", messageID, err)
+	}
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQueueBackoff(t *testing.T) {
+	tests := []struct {
+		retryDelay time.Duration
+		attempts   int
+		want       time.Duration
+	}{
+		{time.Minute, 0, time.Minute},
+		{time.Minute, 1, time.Minute},
+		{time.Minute, 2, 2 * time.Minute},
+		{time.Minute, 4, 8 * time.Minute},
+		{time.Minute, 7, maxRetryDelay},
+		{time.Minute, 1000, maxRetryDelay},
+		{2 * time.Hour, 1, maxRetryDelay},
+		{45 * time.Minute, 2, maxRetryDelay},
+	}
+	for _, tt := range tests {
+		q := NewQueue(nil, 5, tt.retryDelay)
+		if got := q.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) with retry delay %v = %v, want %v", tt.attempts, tt.retryDelay, got, tt.want)
+		}
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	err := Permanent(ErrJobNotFound)
+	var permanent *PermanentError
+	if !errors.As(err, &permanent) || !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Permanent(%v) = %#v, want a *PermanentError wrapping it", ErrJobNotFound, err)
+	}
+	if err.Error() != ErrJobNotFound.Error() {
+		t.Errorf("Permanent(%v).Error() = %q, want %q", ErrJobNotFound, err.Error(), ErrJobNotFound.Error())
+	}
+}
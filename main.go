@@ -1,15 +1,40 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"vt-data-pipeline/api"
 	"vt-data-pipeline/config"
 	"vt-data-pipeline/db"
+	"vt-data-pipeline/jobs"
+	"vt-data-pipeline/metrics"
+	"vt-data-pipeline/ratelimit"
 	"vt-data-pipeline/redis"
+	"vt-data-pipeline/services"
+	"vt-data-pipeline/vtclient"
+	"vt-data-pipeline/webhook"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	// "server" (default) runs the HTTP API, "worker" only the job consumers,
+	// "webhook-receiver" a local endpoint for trying out alert webhooks
+	mode := "server"
+	if len(os.Args) > 1 {
+		mode = os.Args[1]
+	}
+	if mode == "webhook-receiver" {
+		runWebhookReceiver()
+		return
+	}
+
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		panic("Failed to load config: " + err.Error())
@@ -25,13 +50,96 @@ func main() {
 	}
 	defer redisClient.Close()
 
+	// Initialize VirusTotal client over the key pool, throttled by a limiter shared through Redis
+	limiter := ratelimit.NewLimiter(redisClient, cfg.VirusTotal.RateLimitMaxWait)
+	keys := make([]vtclient.Key, len(cfg.VirusTotal.APIKeys))
+	for i, k := range cfg.VirusTotal.APIKeys {
+		keys[i] = vtclient.Key{
+			Value:  k.Key,
+			Tier:   k.Tier,
+			Budget: ratelimit.Budget{PerMinute: k.RequestsPerMinute, PerDay: k.RequestsPerDay},
+		}
+	}
+	keyPool := vtclient.NewKeyPool(keys, limiter, redisClient, cfg.VirusTotal.CredentialQuarantine, cfg.VirusTotal.QuotaQuarantine)
+	vtClient := vtclient.NewClient(keyPool)
+
+	// Asynchronous fetch jobs are queued on a Redis stream
+	queue := jobs.NewQueue(redisClient, cfg.Jobs.MaxAttempts, cfg.Jobs.RetryDelay)
+	notifier := services.NewAlertNotifier(dbConn, services.AlertThresholds{
+		MaliciousIncrease:  cfg.Alerts.MaliciousIncrease,
+		SuspiciousIncrease: cfg.Alerts.SuspiciousIncrease,
+		ReputationDrop:     cfg.Alerts.ReputationDrop,
+		EngineFlips:        cfg.Alerts.EngineFlips,
+	}, cfg.Alerts.WebhookURLs, cfg.Alerts.WebhookSecret)
+	jobHandler := services.FetchJobHandler(dbConn, redisClient, vtClient, notifier, cfg.Freshness)
+
+	// Watched indicators are refreshed through the same queue, every process runs the scheduler
+	// and a Redis lock picks one of them per tick
+	scheduler := services.NewWatchlistScheduler(dbConn, redisClient, keyPool, queue, cfg.Watchlist.Tick, cfg.Watchlist.BudgetPercent)
+
+	// Negative cache metrics are exported by every process, most negative cache writes happen in workers
+	services.RegisterNegativeCacheMetrics(dbConn)
+
+	switch mode {
+	case "worker":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go scheduler.Run(ctx)
+		go func() {
+			if err := metrics.Serve(ctx, ":"+cfg.Jobs.MetricsPort); err != nil {
+				log.Printf("Metrics server exited: %v", err)
+			}
+		}()
+		log.Printf("Starting worker with %d consumers", cfg.Jobs.Concurrency)
+		if err := queue.RunWorkers(ctx, consumerName(), cfg.Jobs.Concurrency, jobHandler); err != nil {
+			panic("Worker failed: " + err.Error())
+		}
+		log.Printf("Worker stopped")
+		return
+	case "server":
+	default:
+		panic("Unknown mode " + mode + " (allowed: server, worker, webhook-receiver)")
+	}
+
+	go scheduler.Run(context.Background())
+	if cfg.Jobs.InlineConsumer {
+		go func() {
+			if err := queue.Run(context.Background(), consumerName(), jobHandler); err != nil {
+				log.Printf("Job consumer exited: %v", err)
+			}
+		}()
+	}
+
 	r := gin.Default()
+	// Route on the raw path so that percent-encoded slashes in URL report ids stay inside :id
+	r.UseRawPath = true
 	if err := r.SetTrustedProxies([]string{"127.0.0.1"}); err != nil {
 		panic("Failed to set trusted proxies: " + err.Error())
 	}
-	api.SetupRoutes(r, dbConn, redisClient, cfg)
+	api.SetupRoutes(r, dbConn, redisClient, vtClient, keyPool, queue, cfg)
 
 	if err := r.Run(":" + cfg.Server.Port); err != nil {
 		panic("Failed to start server: " + err.Error())
 	}
 }
+
+// consumerName identifies this process in the job stream's consumer group
+func consumerName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// runWebhookReceiver serves webhook.Receiver on RECEIVER_PORT (default 9090), verifying signatures with ALERT_WEBHOOK_SECRET
+func runWebhookReceiver() {
+	port := os.Getenv("RECEIVER_PORT")
+	if port == "" {
+		port = "9090"
+	}
+	log.Printf("Webhook receiver listening on :%s", port)
+	if err := http.ListenAndServe(":"+port, webhook.Receiver(os.Getenv("ALERT_WEBHOOK_SECRET"))); err != nil {
+		panic("Failed to start webhook receiver: " + err.Error())
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx/types"
+)
+
+// Alert represents the alerts table
+type Alert struct {
+	ID             int64          `db:"id" json:"id"`
+	Indicator      string         `db:"indicator" json:"indicator"`
+	Type           string         `db:"type" json:"type"`
+	Reasons        types.JSONText `db:"reasons" json:"reasons"`
+	Diff           types.JSONText `db:"diff" json:"diff"`
+	FromSnapshotID int64          `db:"from_snapshot_id" json:"from_snapshot_id"`
+	ToSnapshotID   int64          `db:"to_snapshot_id" json:"to_snapshot_id"`
+	CreatedAt      time.Time      `db:"created_at" json:"created_at"`
+	DeliveredAt    *time.Time     `db:"delivered_at" json:"delivered_at,omitempty"`
+	DeliveryError  *string        `db:"delivery_error" json:"delivery_error,omitempty"`
+}
+
+// AlertWebhookPayload is the JSON body posted to alert webhooks
+type AlertWebhookPayload struct {
+	Event string `json:"event"`
+	Alert *Alert `json:"alert"`
+}
@@ -0,0 +1,32 @@
+package models
+
+// Batch item statuses
+const (
+	BatchCached   = "cached"    // Served from Redis
+	BatchStored   = "stored"    // Served from fresh DB data
+	BatchQueued   = "queued"    // Fetch job queued, poll GET /jobs/:job_id
+	BatchInvalid  = "invalid"   // Unsupported type or malformed id
+	BatchNotFound = "not_found" // VirusTotal recently reported the indicator as unknown
+	BatchError    = "error"     // Any other failure
+)
+
+// BatchItem is one indicator of a batch lookup
+type BatchItem struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// BatchRequest is the body of POST /reports/batch
+type BatchRequest struct {
+	Items []BatchItem `json:"items"`
+}
+
+// BatchResult is the outcome of one batch item, in the order of the request
+type BatchResult struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Report any    `json:"report,omitempty"`
+	JobID  string `json:"job_id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
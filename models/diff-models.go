@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// SnapshotRef identifies the snapshot on one side of a diff
+type SnapshotRef struct {
+	ID           int64     `json:"id"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	ResponseHash string    `json:"response_hash"`
+}
+
+// IntChange is a numeric field that differs between two snapshots
+type IntChange struct {
+	From *int `json:"from"`
+	To   *int `json:"to"`
+}
+
+// StringChange is a string field that differs between two snapshots
+type StringChange struct {
+	From *string `json:"from"`
+	To   *string `json:"to"`
+}
+
+// VerdictChange is an engine whose category flipped. An empty side means the engine was not in that report.
+type VerdictChange struct {
+	Engine string `json:"engine"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+// ReportDiff is the difference between two snapshots of a domain or IP
+type ReportDiff struct {
+	ID                string               `json:"id"`
+	Type              string               `json:"type"`
+	From              SnapshotRef          `json:"from"`
+	To                SnapshotRef          `json:"to"`
+	Changed           bool                 `json:"changed"`
+	Reputation        *IntChange           `json:"reputation,omitempty"`
+	Stats             map[string]IntChange `json:"stats,omitempty"`
+	Verdicts          []VerdictChange      `json:"verdicts,omitempty"`
+	TagsAdded         []string             `json:"tags_added,omitempty"`
+	TagsRemoved       []string             `json:"tags_removed,omitempty"`
+	DNSRecordsAdded   []DNSRecord          `json:"dns_records_added,omitempty"`
+	DNSRecordsRemoved []DNSRecord          `json:"dns_records_removed,omitempty"`
+	Certificate       *StringChange        `json:"certificate,omitempty"`
+}
@@ -64,32 +64,64 @@ type CacheEntry struct {
 	ExpiresAt time.Time      `db:"expires_at" json:"expires_at"`
 }
 
+// EngineResult is the verdict of one engine in last_analysis_results
+type EngineResult struct {
+	Category string `json:"category"`
+	Result   string `json:"result"`
+	Method   string `json:"method"`
+}
+
 // VirusTotalResponse represents the response from VirusTotal API
 type VirusTotalDomainResponse struct {
 	Data struct {
 		Attributes struct {
-			CreationDate        int64             `json:"creation_date"`
-			ExpirationDate      int64             `json:"expiration_date"`
-			LastAnalysisDate    int64             `json:"last_analysis_date"`
-			Reputation          int               `json:"reputation"`
-			Registrar           string            `json:"registrar"`
-			TLD                 string            `json:"tld"`
-			WhoisDate           int64             `json:"whois_date"`
-			LastAnalysisStats   map[string]int    `json:"last_analysis_stats"`
-			Categories          map[string]string `json:"categories"`
-			LastAnalysisResults map[string]struct {
-				Category string `json:"category"`
-				Result   string `json:"result"`
-				Method   string `json:"method"`
-			} `json:"last_analysis_results"`
-			LastDNSRecords       []any  `json:"last_dns_records"`
-			LastHTTPSCertificate any    `json:"last_https_certificate"`
-			RDAP                 any    `json:"rdap"`
-			Whois                string `json:"whois"`
-			PopularityRanks      any    `json:"popularity_ranks"`
-			TotalVotes           any    `json:"total_votes"`
+			CreationDate         int64                   `json:"creation_date"`
+			ExpirationDate       int64                   `json:"expiration_date"`
+			LastAnalysisDate     int64                   `json:"last_analysis_date"`
+			Reputation           int                     `json:"reputation"`
+			Registrar            string                  `json:"registrar"`
+			TLD                  string                  `json:"tld"`
+			WhoisDate            int64                   `json:"whois_date"`
+			LastAnalysisStats    map[string]int          `json:"last_analysis_stats"`
+			Categories           map[string]string       `json:"categories"`
+			LastAnalysisResults  map[string]EngineResult `json:"last_analysis_results"`
+			LastDNSRecords       []any                   `json:"last_dns_records"`
+			LastHTTPSCertificate any                     `json:"last_https_certificate"`
+			RDAP                 any                     `json:"rdap"`
+			Whois                string                  `json:"whois"`
+			PopularityRanks      any                     `json:"popularity_ranks"`
+			TotalVotes           any                     `json:"total_votes"`
 		} `json:"attributes"`
 		ID   string `json:"id"`
 		Type string `json:"type"`
 	} `json:"data"`
 }
+
+// DomainSections lists the sections of a DomainReport
+var DomainSections = []string{SectionCategories, SectionAnalysisResults, SectionDetails}
+
+// DomainReport is the full normalized domain report assembled from all domain tables
+type DomainReport struct {
+	// Type and TypeInferred are set on responses, so callers see the type detected for an id without type=
+	Type            string                 `json:"type,omitempty"`
+	TypeInferred    bool                   `json:"type_inferred,omitempty"`
+	Domain          *Domain                `json:"domain"`
+	Categories      []DomainCategory       `json:"categories,omitempty"`
+	AnalysisResults []DomainAnalysisResult `json:"analysis_results,omitempty"`
+	Details         *DomainDetails         `json:"details,omitempty"`
+}
+
+// Select returns a copy of the report holding only the requested sections
+func (r *DomainReport) Select(sections ReportSections) *DomainReport {
+	out := &DomainReport{Domain: r.Domain}
+	if sections.Has(SectionCategories) {
+		out.Categories = r.Categories
+	}
+	if sections.Has(SectionAnalysisResults) {
+		out.AnalysisResults = r.AnalysisResults
+	}
+	if sections.Has(SectionDetails) {
+		out.Details = r.Details
+	}
+	return out
+}
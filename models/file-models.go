@@ -0,0 +1,106 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx/types"
+)
+
+// File represents the files table
+type File struct {
+	ID                  string         `db:"id" json:"id"`
+	Type                string         `db:"type" json:"type"`
+	MD5                 *string        `db:"md5" json:"md5,omitempty"`
+	SHA1                *string        `db:"sha1" json:"sha1,omitempty"`
+	Size                *int64         `db:"size" json:"size,omitempty"`
+	TypeDescription     *string        `db:"type_description" json:"type_description,omitempty"`
+	TypeTag             *string        `db:"type_tag" json:"type_tag,omitempty"`
+	MeaningfulName      *string        `db:"meaningful_name" json:"meaningful_name,omitempty"`
+	Magic               *string        `db:"magic" json:"magic,omitempty"`
+	FirstSubmissionDate *time.Time     `db:"first_submission_date" json:"first_submission_date,omitempty"`
+	LastSubmissionDate  *time.Time     `db:"last_submission_date" json:"last_submission_date,omitempty"`
+	LastAnalysisDate    *time.Time     `db:"last_analysis_date" json:"last_analysis_date,omitempty"`
+	TimesSubmitted      *int           `db:"times_submitted" json:"times_submitted,omitempty"`
+	Reputation          *int           `db:"reputation" json:"reputation,omitempty"`
+	SignatureInfo       types.JSONText `db:"signature_info" json:"signature_info"`
+	LastAnalysisStats   types.JSONText `db:"last_analysis_stats" json:"last_analysis_stats"`
+	HarmlessCount       *int           `db:"harmless_count" json:"harmless_count,omitempty"`
+	MaliciousCount      *int           `db:"malicious_count" json:"malicious_count,omitempty"`
+	SuspiciousCount     *int           `db:"suspicious_count" json:"suspicious_count,omitempty"`
+	UndetectedCount     *int           `db:"undetected_count" json:"undetected_count,omitempty"`
+	TimeoutCount        *int           `db:"timeout_count" json:"timeout_count,omitempty"`
+	CreatedAt           time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt           time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// FileName represents the file_names table
+type FileName struct {
+	ID     int    `db:"id" json:"id"`
+	FileID string `db:"file_id" json:"file_id"`
+	Name   string `db:"name" json:"name"`
+}
+
+// FileAnalysisResult represents the file_analysis_results table
+type FileAnalysisResult struct {
+	ID         int    `db:"id" json:"id"`
+	FileID     string `db:"file_id" json:"file_id"`
+	EngineName string `db:"engine_name" json:"engine_name"`
+	Category   string `db:"category" json:"category"`
+	Result     string `db:"result" json:"result"`
+	Method     string `db:"method" json:"method"`
+}
+
+// SectionNames selects the submitted file names of a FileReport
+const SectionNames = "names"
+
+// FileSections lists the sections of a FileReport
+var FileSections = []string{SectionNames, SectionAnalysisResults}
+
+// FileReport is the full normalized file report assembled from all file tables
+type FileReport struct {
+	// Type and TypeInferred are set on responses, so callers see the type detected for an id without type=
+	Type            string               `json:"type,omitempty"`
+	TypeInferred    bool                 `json:"type_inferred,omitempty"`
+	File            *File                `json:"file"`
+	Names           []FileName           `json:"names,omitempty"`
+	AnalysisResults []FileAnalysisResult `json:"analysis_results,omitempty"`
+}
+
+// Select returns a copy of the report holding only the requested sections
+func (r *FileReport) Select(sections ReportSections) *FileReport {
+	out := &FileReport{File: r.File}
+	if sections.Has(SectionNames) {
+		out.Names = r.Names
+	}
+	if sections.Has(SectionAnalysisResults) {
+		out.AnalysisResults = r.AnalysisResults
+	}
+	return out
+}
+
+// VirusTotalFileResponse represents the response structure from VirusTotal API for files
+type VirusTotalFileResponse struct {
+	Data struct {
+		Attributes struct {
+			MD5                 string                  `json:"md5"`
+			SHA1                string                  `json:"sha1"`
+			SHA256              string                  `json:"sha256"`
+			Size                int64                   `json:"size"`
+			TypeDescription     string                  `json:"type_description"`
+			TypeTag             string                  `json:"type_tag"`
+			MeaningfulName      string                  `json:"meaningful_name"`
+			Magic               string                  `json:"magic"`
+			Names               []string                `json:"names"`
+			FirstSubmissionDate int64                   `json:"first_submission_date"`
+			LastSubmissionDate  int64                   `json:"last_submission_date"`
+			LastAnalysisDate    int64                   `json:"last_analysis_date"`
+			TimesSubmitted      int                     `json:"times_submitted"`
+			Reputation          int                     `json:"reputation"`
+			SignatureInfo       any                     `json:"signature_info"`
+			LastAnalysisStats   map[string]int          `json:"last_analysis_stats"`
+			LastAnalysisResults map[string]EngineResult `json:"last_analysis_results"`
+		} `json:"attributes"`
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	} `json:"data"`
+}
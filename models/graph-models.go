@@ -0,0 +1,45 @@
+package models
+
+// Graph node types
+const (
+	NodeDomain      = "domain"
+	NodeIPAddress   = "ip_address"
+	NodeNetwork     = "network"
+	NodeAS          = "as"
+	NodeRegistrar   = "registrar"
+	NodeCertificate = "certificate"
+	NodeFile        = "file"
+	NodeURL         = "url"
+)
+
+// GraphNode is an indicator or shared attribute in a pivot graph
+type GraphNode struct {
+	ID    string         `json:"id"`
+	Type  string         `json:"type"`
+	Label string         `json:"label"`
+	Depth int            `json:"depth"`
+	Data  map[string]any `json:"data,omitempty"`
+}
+
+// GraphEdge links two nodes of a pivot graph
+type GraphEdge struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Relation string `json:"relation"`
+}
+
+// Graph is a node/edge pivot graph built from the stored indicators
+type Graph struct {
+	Root      string      `json:"root"`
+	Depth     int         `json:"depth"`
+	Nodes     []GraphNode `json:"nodes"`
+	Edges     []GraphEdge `json:"edges"`
+	Truncated bool        `json:"truncated"`
+}
+
+// DNSRecord is one entry of domain_details.last_dns_records
+type DNSRecord struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	TTL   int    `json:"ttl"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"net/netip"
 	"time"
 
 	"github.com/jmoiron/sqlx/types"
@@ -16,6 +17,7 @@ type IPAddress struct {
 	ASOwner                  *string    `db:"as_owner" json:"as_owner,omitempty"`
 	RegionalInternetRegistry *string    `db:"regional_internet_registry" json:"regional_internet_registry,omitempty"`
 	Network                  *string    `db:"network" json:"network,omitempty"`
+	Address                  *string    `db:"address" json:"-"`
 	WhoisDate                *time.Time `db:"whois_date" json:"whois_date,omitempty"`
 	LastModificationDate     *time.Time `db:"last_modification_date" json:"last_modification_date,omitempty"`
 	Continent                *string    `db:"continent" json:"continent,omitempty"`
@@ -28,6 +30,26 @@ type IPAddress struct {
 	UpdatedAt                time.Time  `db:"updated_at" json:"updated_at"`
 }
 
+// Addr returns the parsed IP address
+func (ip *IPAddress) Addr() (netip.Addr, error) {
+	return netip.ParseAddr(ip.ID)
+}
+
+// Prefix returns the parsed network the IP is announced in, ok is false when none is known
+func (ip *IPAddress) Prefix() (prefix netip.Prefix, ok bool) {
+	if ip.Network == nil {
+		return netip.Prefix{}, false
+	}
+	prefix, err := netip.ParsePrefix(*ip.Network)
+	return prefix, err == nil
+}
+
+// IsIPv6 reports whether the IP is an IPv6 address
+func (ip *IPAddress) IsIPv6() bool {
+	addr, err := ip.Addr()
+	return err == nil && addr.Is6()
+}
+
 type IPTag struct {
 	ID   int    `db:"id" json:"id"`
 	IPID string `db:"ip_id" json:"ip_id"`
@@ -54,27 +76,52 @@ type IPDetails struct {
 type VirusTotalIPResponse struct {
 	Data struct {
 		Attributes struct {
-			LastAnalysisDate         int64          `json:"last_analysis_date"`
-			ASN                      int            `json:"asn"`
-			Reputation               int            `json:"reputation"`
-			Country                  string         `json:"country"`
-			ASOwner                  string         `json:"as_owner"`
-			RegionalInternetRegistry string         `json:"regional_internet_registry"`
-			Network                  string         `json:"network"`
-			WhoisDate                int64          `json:"whois_date"`
-			LastModificationDate     int64          `json:"last_modification_date"`
-			Continent                string         `json:"continent"`
-			Tags                     []string       `json:"tags"`
-			LastAnalysisStats        map[string]int `json:"last_analysis_stats"`
-			LastAnalysisResults      map[string]struct {
-				Category string `json:"category"`
-				Result   string `json:"result"`
-				Method   string `json:"method"`
-			} `json:"last_analysis_results"`
-			Whois      string `json:"whois"`
-			TotalVotes any    `json:"total_votes"`
+			LastAnalysisDate         int64                   `json:"last_analysis_date"`
+			ASN                      int                     `json:"asn"`
+			Reputation               int                     `json:"reputation"`
+			Country                  string                  `json:"country"`
+			ASOwner                  string                  `json:"as_owner"`
+			RegionalInternetRegistry string                  `json:"regional_internet_registry"`
+			Network                  string                  `json:"network"`
+			WhoisDate                int64                   `json:"whois_date"`
+			LastModificationDate     int64                   `json:"last_modification_date"`
+			Continent                string                  `json:"continent"`
+			Tags                     []string                `json:"tags"`
+			LastAnalysisStats        map[string]int          `json:"last_analysis_stats"`
+			LastAnalysisResults      map[string]EngineResult `json:"last_analysis_results"`
+			Whois                    string                  `json:"whois"`
+			TotalVotes               any                     `json:"total_votes"`
 		} `json:"attributes"`
 		ID   string `json:"id"`
 		Type string `json:"type"`
 	} `json:"data"`
 }
+
+// IPSections lists the sections of an IPReport
+var IPSections = []string{SectionTags, SectionAnalysisResults, SectionDetails}
+
+// IPReport is the full normalized IP report assembled from all IP tables
+type IPReport struct {
+	// Type and TypeInferred are set on responses, so callers see the type detected for an id without type=
+	Type            string             `json:"type,omitempty"`
+	TypeInferred    bool               `json:"type_inferred,omitempty"`
+	IP              *IPAddress         `json:"ip"`
+	Tags            []IPTag            `json:"tags,omitempty"`
+	AnalysisResults []IPAnalysisResult `json:"analysis_results,omitempty"`
+	Details         *IPDetails         `json:"details,omitempty"`
+}
+
+// Select returns a copy of the report holding only the requested sections
+func (r *IPReport) Select(sections ReportSections) *IPReport {
+	out := &IPReport{IP: r.IP}
+	if sections.Has(SectionTags) {
+		out.Tags = r.Tags
+	}
+	if sections.Has(SectionAnalysisResults) {
+		out.AnalysisResults = r.AnalysisResults
+	}
+	if sections.Has(SectionDetails) {
+		out.Details = r.Details
+	}
+	return out
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job statuses
+const (
+	JobQueued    = "queued"    // Waiting for a consumer
+	JobRunning   = "running"   // Being fetched
+	JobRetrying  = "retrying"  // Failed transiently, retried at retry_at
+	JobSucceeded = "succeeded" // Report available in result
+	JobFailed    = "failed"    // Gave up, see error
+)
+
+// Job is an asynchronous report fetch. Refresh jobs bypass the cache and DB freshness checks and always call VirusTotal.
+type Job struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Indicator  string          `json:"indicator"`
+	Refresh    bool            `json:"refresh,omitempty"`
+	Scheduled  bool            `json:"scheduled,omitempty"` // Queued by the watchlist scheduler
+	Status     string          `json:"status"`
+	Attempts   int             `json:"attempts"`
+	Error      string          `json:"error,omitempty"`
+	RetryAt    *time.Time      `json:"retry_at,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// Done reports whether the job reached a final status
+func (j *Job) Done() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
+
+// JobRequest is the body of POST /jobs
+type JobRequest struct {
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	ForceRefresh bool   `json:"force_refresh"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// NotFoundIndicator represents the not_found_indicators table
+type NotFoundIndicator struct {
+	Indicator     string    `db:"indicator" json:"indicator"`
+	Type          string    `db:"type" json:"type"`
+	FirstSeenAt   time.Time `db:"first_seen_at" json:"first_seen_at"`
+	LastSeenAt    time.Time `db:"last_seen_at" json:"last_seen_at"`
+	NotFoundCount int       `db:"not_found_count" json:"not_found_count"`
+	ExpiresAt     time.Time `db:"expires_at" json:"expires_at"`
+}
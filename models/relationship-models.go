@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Relationship represents the relationships edge table
+type Relationship struct {
+	ID         int        `db:"id" json:"id"`
+	SourceType string     `db:"source_type" json:"source_type"`
+	SourceID   string     `db:"source_id" json:"source_id"`
+	Relation   string     `db:"relation" json:"relation"`
+	TargetType string     `db:"target_type" json:"target_type"`
+	TargetID   string     `db:"target_id" json:"target_id"`
+	FirstSeen  *time.Time `db:"first_seen" json:"first_seen,omitempty"`
+	LastSeen   *time.Time `db:"last_seen" json:"last_seen,omitempty"`
+}
+
+// RelationshipFetch represents the relationship_fetches table
+type RelationshipFetch struct {
+	SourceType string    `db:"source_type" json:"source_type"`
+	SourceID   string    `db:"source_id" json:"source_id"`
+	Relation   string    `db:"relation" json:"relation"`
+	FetchedAt  time.Time `db:"fetched_at" json:"fetched_at"`
+}
+
+// VirusTotalRelationshipResponse represents one page of related objects from /{collection}/{id}/{relationship}.
+// Only the attributes needed to build edges are decoded.
+type VirusTotalRelationshipResponse struct {
+	Data []struct {
+		ID         string `json:"id"`
+		Type       string `json:"type"`
+		Attributes struct {
+			Date                int64  `json:"date"`
+			HostName            string `json:"host_name"`
+			IPAddress           string `json:"ip_address"`
+			URL                 string `json:"url"`
+			FirstSubmissionDate int64  `json:"first_submission_date"`
+			LastSubmissionDate  int64  `json:"last_submission_date"`
+		} `json:"attributes"`
+	} `json:"data"`
+	Meta struct {
+		Cursor string `json:"cursor"`
+		Count  int    `json:"count"`
+	} `json:"meta"`
+}
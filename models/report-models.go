@@ -0,0 +1,50 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// Report sections that can be picked with the include= query parameter
+const (
+	SectionCategories      = "categories"
+	SectionTags            = "tags"
+	SectionAnalysisResults = "analysis_results"
+	SectionDetails         = "details"
+)
+
+// ReportSections is the set of sections requested for a report. A nil set means all sections.
+type ReportSections map[string]bool
+
+// ParseReportSections parses a comma separated include= value against the sections allowed for a report type
+func ParseReportSections(include string, allowed ...string) (ReportSections, error) {
+	include = strings.TrimSpace(include)
+	if include == "" || include == "all" {
+		return nil, nil
+	}
+
+	sections := ReportSections{}
+	for _, name := range strings.Split(include, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		valid := false
+		for _, a := range allowed {
+			if name == a {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, errors.New("unsupported include section: " + name + " (allowed: " + strings.Join(allowed, ", ") + ")")
+		}
+		sections[name] = true
+	}
+	return sections, nil
+}
+
+// Has reports whether the section was requested
+func (s ReportSections) Has(name string) bool {
+	return s == nil || s[name]
+}
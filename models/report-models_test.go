@@ -0,0 +1,44 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseReportSections(t *testing.T) {
+	tests := []struct {
+		include string
+		want    ReportSections
+		wantErr bool
+	}{
+		{include: "", want: nil},
+		{include: "  ", want: nil},
+		{include: "all", want: nil},
+		{include: "details", want: ReportSections{SectionDetails: true}},
+		{include: "categories, analysis_results,", want: ReportSections{SectionCategories: true, SectionAnalysisResults: true}},
+		{include: ",,", want: ReportSections{}},
+		{include: "tags", wantErr: true},
+		{include: "details,Details", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseReportSections(tt.include, DomainSections...)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseReportSections(%q) error = %v, wantErr %v", tt.include, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseReportSections(%q) = %v, want %v", tt.include, got, tt.want)
+		}
+	}
+}
+
+func TestReportSectionsHas(t *testing.T) {
+	var all ReportSections
+	if !all.Has(SectionDetails) {
+		t.Error("nil ReportSections should include every section")
+	}
+	some := ReportSections{SectionCategories: true}
+	if !some.Has(SectionCategories) || some.Has(SectionDetails) {
+		t.Errorf("ReportSections %v: Has(categories) = %v, Has(details) = %v", some, some.Has(SectionCategories), some.Has(SectionDetails))
+	}
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"net/netip"
+	"time"
+)
+
+// IPSearch holds the filters, order and page of GET /ips. Nil and empty filters match everything.
+type IPSearch struct {
+	CIDR         *netip.Prefix
+	ASN          *int
+	Country      string
+	MinMalicious *int
+	Sort         string
+	Limit        int
+	Offset       int
+}
+
+// DomainSearch holds the filters, order and page of GET /domains. Nil and empty filters match everything.
+// AfterKey and AfterID come from the cursor and select the rows after the last row of the previous page.
+type DomainSearch struct {
+	TLD           string
+	Registrar     string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	ExpiresAfter  *time.Time
+	ExpiresBefore *time.Time
+	MinReputation *int
+	MaxReputation *int
+	MinMalicious  *int
+	Category      string
+	Whois         string
+	Sort          string
+	Limit         int
+	AfterKey      *string
+	AfterID       *string
+}
+
+// DomainSearchResult is a domains row with the value it was sorted by, used to build the next cursor
+type DomainSearchResult struct {
+	Domain
+	SortKey string `db:"sort_key" json:"-"`
+}
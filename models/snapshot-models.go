@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx/types"
+)
+
+// DomainSnapshot represents the domain_snapshots table
+type DomainSnapshot struct {
+	ID                    int64          `db:"id" json:"id"`
+	DomainID              string         `db:"domain_id" json:"domain_id"`
+	FetchedAt             time.Time      `db:"fetched_at" json:"fetched_at"`
+	LastAnalysisDate      *time.Time     `db:"last_analysis_date" json:"last_analysis_date,omitempty"`
+	Reputation            *int           `db:"reputation" json:"reputation,omitempty"`
+	HarmlessCount         *int           `db:"harmless_count" json:"harmless_count,omitempty"`
+	MaliciousCount        *int           `db:"malicious_count" json:"malicious_count,omitempty"`
+	SuspiciousCount       *int           `db:"suspicious_count" json:"suspicious_count,omitempty"`
+	UndetectedCount       *int           `db:"undetected_count" json:"undetected_count,omitempty"`
+	TimeoutCount          *int           `db:"timeout_count" json:"timeout_count,omitempty"`
+	Verdicts              types.JSONText `db:"verdicts" json:"verdicts"`
+	DNSRecords            types.JSONText `db:"dns_records" json:"dns_records"`
+	CertificateThumbprint *string        `db:"certificate_thumbprint" json:"certificate_thumbprint,omitempty"`
+	ResponseHash          string         `db:"response_hash" json:"response_hash"`
+}
+
+// IPSnapshot represents the ip_snapshots table
+type IPSnapshot struct {
+	ID               int64          `db:"id" json:"id"`
+	IPID             string         `db:"ip_id" json:"ip_id"`
+	FetchedAt        time.Time      `db:"fetched_at" json:"fetched_at"`
+	LastAnalysisDate *time.Time     `db:"last_analysis_date" json:"last_analysis_date,omitempty"`
+	Reputation       *int           `db:"reputation" json:"reputation,omitempty"`
+	HarmlessCount    *int           `db:"harmless_count" json:"harmless_count,omitempty"`
+	MaliciousCount   *int           `db:"malicious_count" json:"malicious_count,omitempty"`
+	SuspiciousCount  *int           `db:"suspicious_count" json:"suspicious_count,omitempty"`
+	UndetectedCount  *int           `db:"undetected_count" json:"undetected_count,omitempty"`
+	TimeoutCount     *int           `db:"timeout_count" json:"timeout_count,omitempty"`
+	Verdicts         types.JSONText `db:"verdicts" json:"verdicts"`
+	Tags             types.JSONText `db:"tags" json:"tags"`
+	ResponseHash     string         `db:"response_hash" json:"response_hash"`
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx/types"
+)
+
+// URL represents the urls table
+type URL struct {
+	ID                   string     `db:"id" json:"id"`
+	Type                 string     `db:"type" json:"type"`
+	URL                  string     `db:"url" json:"url"`
+	LastFinalURL         *string    `db:"last_final_url" json:"last_final_url,omitempty"`
+	Title                *string    `db:"title" json:"title,omitempty"`
+	FirstSubmissionDate  *time.Time `db:"first_submission_date" json:"first_submission_date,omitempty"`
+	LastSubmissionDate   *time.Time `db:"last_submission_date" json:"last_submission_date,omitempty"`
+	LastAnalysisDate     *time.Time `db:"last_analysis_date" json:"last_analysis_date,omitempty"`
+	Reputation           *int       `db:"reputation" json:"reputation,omitempty"`
+	TimesSubmitted       *int       `db:"times_submitted" json:"times_submitted,omitempty"`
+	LastHTTPResponseCode *int       `db:"last_http_response_code" json:"last_http_response_code,omitempty"`
+	HarmlessCount        *int       `db:"harmless_count" json:"harmless_count,omitempty"`
+	MaliciousCount       *int       `db:"malicious_count" json:"malicious_count,omitempty"`
+	SuspiciousCount      *int       `db:"suspicious_count" json:"suspicious_count,omitempty"`
+	UndetectedCount      *int       `db:"undetected_count" json:"undetected_count,omitempty"`
+	TimeoutCount         *int       `db:"timeout_count" json:"timeout_count,omitempty"`
+	CreatedAt            time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt            time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// URLAnalysisResult represents the url_analysis_results table
+type URLAnalysisResult struct {
+	ID         int    `db:"id" json:"id"`
+	URLID      string `db:"url_id" json:"url_id"`
+	EngineName string `db:"engine_name" json:"engine_name"`
+	Category   string `db:"category" json:"category"`
+	Result     string `db:"result" json:"result"`
+	Method     string `db:"method" json:"method"`
+}
+
+// URLDetails represents the url_details table
+type URLDetails struct {
+	ID                      int            `db:"id" json:"id"`
+	URLID                   string         `db:"url_id" json:"url_id"`
+	Categories              types.JSONText `db:"categories" json:"categories"`
+	Tags                    types.JSONText `db:"tags" json:"tags"`
+	ThreatNames             types.JSONText `db:"threat_names" json:"threat_names"`
+	RedirectionChain        types.JSONText `db:"redirection_chain" json:"redirection_chain"`
+	LastHTTPResponseHeaders types.JSONText `db:"last_http_response_headers" json:"last_http_response_headers"`
+	OutgoingLinks           types.JSONText `db:"outgoing_links" json:"outgoing_links"`
+	HTMLMeta                types.JSONText `db:"html_meta" json:"html_meta"`
+	TotalVotes              types.JSONText `db:"total_votes" json:"total_votes"`
+}
+
+// URLSections lists the sections of a URLReport
+var URLSections = []string{SectionAnalysisResults, SectionDetails}
+
+// URLReport is the full normalized URL report assembled from all URL tables
+type URLReport struct {
+	// Type and TypeInferred are set on responses, so callers see the type detected for an id without type=
+	Type            string              `json:"type,omitempty"`
+	TypeInferred    bool                `json:"type_inferred,omitempty"`
+	URL             *URL                `json:"url"`
+	AnalysisResults []URLAnalysisResult `json:"analysis_results,omitempty"`
+	Details         *URLDetails         `json:"details,omitempty"`
+}
+
+// Select returns a copy of the report holding only the requested sections
+func (r *URLReport) Select(sections ReportSections) *URLReport {
+	out := &URLReport{URL: r.URL}
+	if sections.Has(SectionAnalysisResults) {
+		out.AnalysisResults = r.AnalysisResults
+	}
+	if sections.Has(SectionDetails) {
+		out.Details = r.Details
+	}
+	return out
+}
+
+// VirusTotalURLResponse represents the response structure from VirusTotal API for URLs
+type VirusTotalURLResponse struct {
+	Data struct {
+		Attributes struct {
+			URL                     string                  `json:"url"`
+			LastFinalURL            string                  `json:"last_final_url"`
+			Title                   string                  `json:"title"`
+			FirstSubmissionDate     int64                   `json:"first_submission_date"`
+			LastSubmissionDate      int64                   `json:"last_submission_date"`
+			LastAnalysisDate        int64                   `json:"last_analysis_date"`
+			Reputation              int                     `json:"reputation"`
+			TimesSubmitted          int                     `json:"times_submitted"`
+			LastHTTPResponseCode    int                     `json:"last_http_response_code"`
+			LastAnalysisStats       map[string]int          `json:"last_analysis_stats"`
+			LastAnalysisResults     map[string]EngineResult `json:"last_analysis_results"`
+			Categories              map[string]string       `json:"categories"`
+			Tags                    []string                `json:"tags"`
+			ThreatNames             []string                `json:"threat_names"`
+			RedirectionChain        []string                `json:"redirection_chain"`
+			LastHTTPResponseHeaders map[string]string       `json:"last_http_response_headers"`
+			OutgoingLinks           []string                `json:"outgoing_links"`
+			HTMLMeta                any                     `json:"html_meta"`
+			TotalVotes              any                     `json:"total_votes"`
+		} `json:"attributes"`
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	} `json:"data"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// WatchlistEntry represents the watchlist table
+type WatchlistEntry struct {
+	ID                      int        `db:"id" json:"id"`
+	Indicator               string     `db:"indicator" json:"indicator"`
+	Type                    string     `db:"type" json:"type"`
+	RefreshIntervalSeconds  int        `db:"refresh_interval_seconds" json:"refresh_interval_seconds"`
+	NextRefreshAt           time.Time  `db:"next_refresh_at" json:"next_refresh_at"`
+	LastEnqueuedAt          *time.Time `db:"last_enqueued_at" json:"last_enqueued_at,omitempty"`
+	LastEvaluatedSnapshotID *int64     `db:"last_evaluated_snapshot_id" json:"last_evaluated_snapshot_id,omitempty"`
+	CreatedAt               time.Time  `db:"created_at" json:"created_at"`
+}
+
+// WatchlistRequest is the body of POST /watchlist. Interval is a duration such as 6h.
+type WatchlistRequest struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Interval string `json:"interval"`
+}
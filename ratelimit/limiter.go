@@ -0,0 +1,190 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"vt-data-pipeline/redis"
+)
+
+// ErrQuotaExhausted is matched by every *QuotaExhaustedError
+var ErrQuotaExhausted = errors.New("quota exhausted")
+
+// QuotaExhaustedError is returned when no token becomes available within the limiter's maximum wait
+type QuotaExhaustedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *QuotaExhaustedError) Error() string {
+	return fmt.Sprintf("VirusTotal quota exhausted, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+// Is makes errors.Is(err, ErrQuotaExhausted) match
+func (e *QuotaExhaustedError) Is(target error) bool {
+	return target == ErrQuotaExhausted
+}
+
+// Budget is the number of requests allowed per minute and per day
+type Budget struct {
+	PerMinute int
+	PerDay    int
+}
+
+// Remaining is the number of whole tokens left in each bucket
+type Remaining struct {
+	Minute int `json:"minute"`
+	Day    int `json:"day"`
+}
+
+// tokenBucketScript refills and takes ARGV[1] tokens from every bucket in KEYS atomically.
+// Bucket i has capacity ARGV[2i] and refill rate ARGV[2i+1] tokens per millisecond.
+// Tokens are only taken when all buckets can pay, otherwise the longest wait in milliseconds is returned.
+// Redis TIME is used so that all replicas share one clock.
+const tokenBucketScript = `
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local cost = tonumber(ARGV[1])
+local tokens = {}
+local wait = 0
+for i = 1, #KEYS do
+  local capacity = tonumber(ARGV[2 * i])
+  local rate = tonumber(ARGV[2 * i + 1])
+  local state = redis.call('HMGET', KEYS[i], 'tokens', 'ts')
+  local current = tonumber(state[1])
+  local ts = tonumber(state[2])
+  if current == nil or ts == nil then
+    current = capacity
+    ts = now
+  end
+  current = math.min(capacity, current + math.max(0, now - ts) * rate)
+  tokens[i] = current
+  if current < cost then
+    local w = math.ceil((cost - current) / rate)
+    if w > wait then wait = w end
+  end
+end
+local allowed = 0
+if wait == 0 then allowed = 1 end
+local result = {allowed, wait}
+for i = 1, #KEYS do
+  local capacity = tonumber(ARGV[2 * i])
+  local rate = tonumber(ARGV[2 * i + 1])
+  if allowed == 1 then tokens[i] = tokens[i] - cost end
+  redis.call('HSET', KEYS[i], 'tokens', tostring(tokens[i]), 'ts', now)
+  redis.call('PEXPIRE', KEYS[i], math.ceil(capacity / rate) + 1000)
+  table.insert(result, math.floor(tokens[i]))
+end
+return result
+`
+
+// Limiter is a Redis backed token bucket limiter with a per-minute and a per-day bucket.
+// All replicas using the same Redis share one budget per bucket name.
+type Limiter struct {
+	redisClient *redis.Client
+	maxWait     time.Duration
+}
+
+// NewLimiter creates a Limiter. Callers are queued for up to maxWait before being rejected; zero rejects immediately.
+func NewLimiter(redisClient *redis.Client, maxWait time.Duration) *Limiter {
+	return &Limiter{
+		redisClient: redisClient,
+		maxWait:     maxWait,
+	}
+}
+
+// Bucket names a token bucket and the budget it refills with
+type Bucket struct {
+	Name   string
+	Budget Budget
+}
+
+// Wait takes one token from the first of the given buckets that has one and returns its index.
+// While no bucket has a token it blocks as long as the shortest wait stays within the limiter's maximum wait,
+// and returns a *QuotaExhaustedError carrying the retry delay otherwise.
+func (l *Limiter) Wait(ctx context.Context, buckets ...Bucket) (int, error) {
+	if len(buckets) == 0 {
+		return -1, errors.New("no rate limit bucket to wait on")
+	}
+
+	deadline := time.Now().Add(l.maxWait)
+	for {
+		shortest := time.Duration(math.MaxInt64)
+		for i, bucket := range buckets {
+			allowed, wait, _, err := l.take(ctx, bucket.Name, bucket.Budget, 1)
+			if err != nil {
+				return -1, err
+			}
+			if allowed {
+				return i, nil
+			}
+			shortest = min(shortest, wait)
+		}
+		if time.Now().Add(shortest).After(deadline) {
+			return -1, &QuotaExhaustedError{RetryAfter: shortest}
+		}
+
+		timer := time.NewTimer(shortest)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return -1, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Remaining reports the tokens left in the named bucket without taking any
+func (l *Limiter) Remaining(ctx context.Context, bucket string, budget Budget) (*Remaining, error) {
+	_, _, remaining, err := l.take(ctx, bucket, budget, 0)
+	if err != nil {
+		return nil, err
+	}
+	return remaining, nil
+}
+
+// take runs the token bucket script for the minute and day buckets of a bucket name
+func (l *Limiter) take(ctx context.Context, bucket string, budget Budget, cost int) (bool, time.Duration, *Remaining, error) {
+	if budget.PerMinute <= 0 || budget.PerDay <= 0 {
+		return false, 0, nil, errors.New("rate limit budget must be positive")
+	}
+
+	keys := []string{
+		fmt.Sprintf("ratelimit:vt:%s:minute", bucket),
+		fmt.Sprintf("ratelimit:vt:%s:day", bucket),
+	}
+	minuteRate := float64(budget.PerMinute) / float64(time.Minute.Milliseconds())
+	dayRate := float64(budget.PerDay) / float64((24 * time.Hour).Milliseconds())
+
+	res, err := l.redisClient.Eval(ctx, tokenBucketScript, keys,
+		cost,
+		budget.PerMinute, formatRate(minuteRate),
+		budget.PerDay, formatRate(dayRate))
+	if err != nil {
+		return false, 0, nil, err
+	}
+
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 4 {
+		return false, 0, nil, fmt.Errorf("unexpected rate limiter reply: %v", res)
+	}
+	ints := make([]int64, len(values))
+	for i, v := range values {
+		n, ok := v.(int64)
+		if !ok {
+			return false, 0, nil, fmt.Errorf("unexpected rate limiter reply: %v", res)
+		}
+		ints[i] = n
+	}
+
+	remaining := &Remaining{Minute: int(ints[2]), Day: int(ints[3])}
+	return ints[0] == 1, time.Duration(ints[1]) * time.Millisecond, remaining, nil
+}
+
+// formatRate renders a refill rate without losing precision in the Lua tonumber conversion
+func formatRate(rate float64) string {
+	return strconv.FormatFloat(rate, 'g', -1, 64)
+}
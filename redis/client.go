@@ -2,11 +2,16 @@ package redis
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// Nil is the error returned by Get when the key does not exist
+var Nil = redis.Nil
+
 type Client struct {
 	client *redis.Client
 }
@@ -37,16 +42,161 @@ func (c *Client) Set(ctx context.Context, key string, value interface{}, expirat
 	return c.client.Set(ctx, key, value, expiration).Err()
 }
 
+// SetNX sets a key only if it does not exist yet and reports whether it was set
+func (c *Client) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	return c.client.SetNX(ctx, key, value, expiration).Result()
+}
+
 // Get retrieves a value by key
 func (c *Client) Get(ctx context.Context, key string) (string, error) {
 	return c.client.Get(ctx, key).Result()
 }
 
+// MGet retrieves several keys in one round trip, with nil for the missing ones
+func (c *Client) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
+	return c.client.MGet(ctx, keys...).Result()
+}
+
 // Delete removes a key
 func (c *Client) Delete(ctx context.Context, key string) error {
 	return c.client.Del(ctx, key).Err()
 }
 
+// TTL returns the remaining time to live of a key, negative when the key has no expiry or does not exist
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return c.client.PTTL(ctx, key).Result()
+}
+
+// HIncrBy increments a hash field by the given amount
+func (c *Client) HIncrBy(ctx context.Context, key, field string, incr int64) error {
+	return c.client.HIncrBy(ctx, key, field, incr).Err()
+}
+
+// HSet sets hash fields from alternating field/value pairs
+func (c *Client) HSet(ctx context.Context, key string, values ...interface{}) error {
+	return c.client.HSet(ctx, key, values...).Err()
+}
+
+// HGetAll returns all fields of a hash
+func (c *Client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return c.client.HGetAll(ctx, key).Result()
+}
+
+// ZAdd adds a member to a sorted set with the given score
+func (c *Client) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	return c.client.ZAdd(ctx, key, redis.Z{Score: score, Member: member}).Err()
+}
+
+// ZRem removes members from a sorted set
+func (c *Client) ZRem(ctx context.Context, key string, members ...interface{}) error {
+	return c.client.ZRem(ctx, key, members...).Err()
+}
+
+// ZRemRangeByScore removes the members of a sorted set with a score between min and max, e.g. "-inf" and "1700000000"
+func (c *Client) ZRemRangeByScore(ctx context.Context, key, min, max string) error {
+	return c.client.ZRemRangeByScore(ctx, key, min, max).Err()
+}
+
+// ZCard returns the number of members of a sorted set
+func (c *Client) ZCard(ctx context.Context, key string) (int64, error) {
+	return c.client.ZCard(ctx, key).Result()
+}
+
+// Eval runs a Lua script atomically on the Redis server
+func (c *Client) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return c.client.Eval(ctx, script, keys, args...).Result()
+}
+
+// StreamMessage is one entry of a Redis stream
+type StreamMessage struct {
+	ID     string
+	Values map[string]interface{}
+}
+
+// XAdd appends an entry to a stream, creating the stream if needed, and returns the entry ID
+func (c *Client) XAdd(ctx context.Context, stream string, values map[string]interface{}) (string, error) {
+	return c.client.XAdd(ctx, &redis.XAddArgs{Stream: stream, Values: values}).Result()
+}
+
+// XAddCapped appends an entry like XAdd and trims the stream to about maxLen entries, dropping the oldest
+func (c *Client) XAddCapped(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) (string, error) {
+	return c.client.XAdd(ctx, &redis.XAddArgs{Stream: stream, MaxLen: maxLen, Approx: true, Values: values}).Result()
+}
+
+// XDel deletes entries from a stream
+func (c *Client) XDel(ctx context.Context, stream string, ids ...string) error {
+	return c.client.XDel(ctx, stream, ids...).Err()
+}
+
+// XGroupCreate creates a consumer group reading the stream from the beginning.
+// It creates the stream if needed and succeeds when the group already exists.
+func (c *Client) XGroupCreate(ctx context.Context, stream, group string) error {
+	err := c.client.XGroupCreateMkStream(ctx, stream, group, "0").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// XReadGroup reads up to count new entries for a consumer, blocking up to block when there are none
+func (c *Client) XReadGroup(ctx context.Context, stream, group, consumer string, count int64, block time.Duration) ([]StreamMessage, error) {
+	streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var messages []StreamMessage
+	for _, s := range streams {
+		for _, m := range s.Messages {
+			messages = append(messages, StreamMessage{ID: m.ID, Values: m.Values})
+		}
+	}
+	return messages, nil
+}
+
+// XAutoClaim takes over up to count entries that have been pending in the group for at least minIdle
+func (c *Client) XAutoClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, count int64) ([]StreamMessage, error) {
+	claimed, _, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Start:    "0-0",
+		Count:    count,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]StreamMessage, len(claimed))
+	for i, m := range claimed {
+		messages[i] = StreamMessage{ID: m.ID, Values: m.Values}
+	}
+	return messages, nil
+}
+
+// XClaimJustID claims pending entries for a consumer without returning them, which resets their idle time
+func (c *Client) XClaimJustID(ctx context.Context, stream, group, consumer string, ids ...string) error {
+	return c.client.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+		Messages: ids,
+	}).Err()
+}
+
+// XAck acknowledges stream entries, removing them from the group's pending list
+func (c *Client) XAck(ctx context.Context, stream, group string, ids ...string) error {
+	return c.client.XAck(ctx, stream, group, ids...).Err()
+}
+
 // Close closes the Redis connection
 func (c *Client) Close() error {
 	return c.client.Close()
@@ -0,0 +1,43 @@
+package repositories
+
+import (
+	"time"
+
+	"vt-data-pipeline/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SaveAlert stores a new alert and fills in its ID and creation time
+func SaveAlert(alert *models.Alert, db *sqlx.DB) error {
+	rows, err := db.NamedQuery(`INSERT INTO alerts (indicator, type, reasons, diff, from_snapshot_id, to_snapshot_id)
+                          VALUES (:indicator, :type, :reasons, :diff, :from_snapshot_id, :to_snapshot_id)
+                          RETURNING id, created_at`, alert)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		return rows.Scan(&alert.ID, &alert.CreatedAt)
+	}
+	return rows.Err()
+}
+
+// MarkAlertDelivery records the outcome of delivering an alert to the webhooks
+func MarkAlertDelivery(id int64, deliveredAt *time.Time, deliveryError *string, db *sqlx.DB) error {
+	_, err := db.Exec("UPDATE alerts SET delivered_at=$2, delivery_error=$3 WHERE id=$1", id, deliveredAt, deliveryError)
+	return err
+}
+
+// GetAlerts retrieves alerts created after since, newest first, optionally for one indicator
+func GetAlerts(indicator, reportType string, since time.Time, limit, offset int, db *sqlx.DB) ([]models.Alert, error) {
+	alerts := []models.Alert{}
+	err := db.Select(&alerts, `SELECT * FROM alerts
+                          WHERE created_at >= $1 AND ($2 = '' OR indicator = $2) AND ($3 = '' OR type = $3)
+                          ORDER BY created_at DESC, id DESC
+                          LIMIT $4 OFFSET $5`, since, indicator, reportType, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
@@ -0,0 +1,176 @@
+package repositories
+
+import (
+	"time"
+
+	"vt-data-pipeline/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// GetDomainReports loads the full reports of the domains updated after freshSince, keyed by ID.
+// Each table is read with a single WHERE ... = ANY($1) query regardless of the number of IDs.
+func GetDomainReports(ids []string, freshSince time.Time, db *sqlx.DB) (map[string]*models.DomainReport, error) {
+	domains := []models.Domain{}
+	if err := db.Select(&domains, "SELECT * FROM domains WHERE id = ANY($1) AND updated_at > $2", pq.Array(ids), freshSince); err != nil {
+		return nil, err
+	}
+	reports := make(map[string]*models.DomainReport, len(domains))
+	found := make([]string, 0, len(domains))
+	for i := range domains {
+		reports[domains[i].ID] = &models.DomainReport{Domain: &domains[i], Categories: []models.DomainCategory{}, AnalysisResults: []models.DomainAnalysisResult{}}
+		found = append(found, domains[i].ID)
+	}
+	if len(found) == 0 {
+		return reports, nil
+	}
+
+	categories := []models.DomainCategory{}
+	if err := db.Select(&categories, "SELECT id, domain_id, engine_name, category FROM domain_categories WHERE domain_id = ANY($1) ORDER BY engine_name", pq.Array(found)); err != nil {
+		return nil, err
+	}
+	for _, category := range categories {
+		reports[category.DomainID].Categories = append(reports[category.DomainID].Categories, category)
+	}
+
+	results := []models.DomainAnalysisResult{}
+	if err := db.Select(&results, "SELECT id, domain_id, engine_name, category, result, method FROM domain_analysis_results WHERE domain_id = ANY($1) ORDER BY engine_name", pq.Array(found)); err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		reports[result.DomainID].AnalysisResults = append(reports[result.DomainID].AnalysisResults, result)
+	}
+
+	details := []models.DomainDetails{}
+	if err := db.Select(&details, `SELECT id, domain_id, last_dns_records, last_https_certificate, rdap, COALESCE(whois, '') AS whois, popularity_ranks, total_votes
+                          FROM domain_details WHERE domain_id = ANY($1)`, pq.Array(found)); err != nil {
+		return nil, err
+	}
+	for i := range details {
+		reports[details[i].DomainID].Details = &details[i]
+	}
+	return reports, nil
+}
+
+// GetIPReports loads the full reports of the IP addresses updated after freshSince, keyed by ID
+func GetIPReports(ids []string, freshSince time.Time, db *sqlx.DB) (map[string]*models.IPReport, error) {
+	ips := []models.IPAddress{}
+	if err := db.Select(&ips, "SELECT * FROM ip_addresses WHERE id = ANY($1) AND updated_at > $2", pq.Array(ids), freshSince); err != nil {
+		return nil, err
+	}
+	reports := make(map[string]*models.IPReport, len(ips))
+	found := make([]string, 0, len(ips))
+	for i := range ips {
+		reports[ips[i].ID] = &models.IPReport{IP: &ips[i], Tags: []models.IPTag{}, AnalysisResults: []models.IPAnalysisResult{}}
+		found = append(found, ips[i].ID)
+	}
+	if len(found) == 0 {
+		return reports, nil
+	}
+
+	tags := []models.IPTag{}
+	if err := db.Select(&tags, "SELECT id, ip_id, tag FROM ip_tags WHERE ip_id = ANY($1) ORDER BY tag", pq.Array(found)); err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		reports[tag.IPID].Tags = append(reports[tag.IPID].Tags, tag)
+	}
+
+	results := []models.IPAnalysisResult{}
+	if err := db.Select(&results, "SELECT id, ip_id, engine_name, category, result, method FROM ip_analysis_results WHERE ip_id = ANY($1) ORDER BY engine_name", pq.Array(found)); err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		reports[result.IPID].AnalysisResults = append(reports[result.IPID].AnalysisResults, result)
+	}
+
+	details := []models.IPDetails{}
+	if err := db.Select(&details, "SELECT id, ip_id, COALESCE(whois, '') AS whois, total_votes FROM ip_details WHERE ip_id = ANY($1)", pq.Array(found)); err != nil {
+		return nil, err
+	}
+	for i := range details {
+		reports[details[i].IPID].Details = &details[i]
+	}
+	return reports, nil
+}
+
+// GetURLReports loads the full reports of the URLs updated after freshSince, keyed by URL identifier
+func GetURLReports(ids []string, freshSince time.Time, db *sqlx.DB) (map[string]*models.URLReport, error) {
+	urls := []models.URL{}
+	if err := db.Select(&urls, "SELECT * FROM urls WHERE id = ANY($1) AND updated_at > $2", pq.Array(ids), freshSince); err != nil {
+		return nil, err
+	}
+	reports := make(map[string]*models.URLReport, len(urls))
+	found := make([]string, 0, len(urls))
+	for i := range urls {
+		reports[urls[i].ID] = &models.URLReport{URL: &urls[i], AnalysisResults: []models.URLAnalysisResult{}}
+		found = append(found, urls[i].ID)
+	}
+	if len(found) == 0 {
+		return reports, nil
+	}
+
+	results := []models.URLAnalysisResult{}
+	if err := db.Select(&results, "SELECT id, url_id, engine_name, category, result, method FROM url_analysis_results WHERE url_id = ANY($1) ORDER BY engine_name", pq.Array(found)); err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		reports[result.URLID].AnalysisResults = append(reports[result.URLID].AnalysisResults, result)
+	}
+
+	details := []models.URLDetails{}
+	if err := db.Select(&details, `SELECT id, url_id, categories, tags, threat_names, redirection_chain, last_http_response_headers, outgoing_links, html_meta, total_votes
+                          FROM url_details WHERE url_id = ANY($1)`, pq.Array(found)); err != nil {
+		return nil, err
+	}
+	for i := range details {
+		reports[details[i].URLID].Details = &details[i]
+	}
+	return reports, nil
+}
+
+// GetFileReports loads the full reports of the files updated after freshSince.
+// Hashes may be SHA-256, SHA-1 or MD5; the result is keyed by each requested hash that matched.
+func GetFileReports(hashes []string, freshSince time.Time, db *sqlx.DB) (map[string]*models.FileReport, error) {
+	files := []models.File{}
+	if err := db.Select(&files, "SELECT * FROM files WHERE (id = ANY($1) OR sha1 = ANY($1) OR md5 = ANY($1)) AND updated_at > $2", pq.Array(hashes), freshSince); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*models.FileReport, len(files))
+	found := make([]string, 0, len(files))
+	for i := range files {
+		byID[files[i].ID] = &models.FileReport{File: &files[i], Names: []models.FileName{}, AnalysisResults: []models.FileAnalysisResult{}}
+		found = append(found, files[i].ID)
+	}
+
+	reports := make(map[string]*models.FileReport, len(hashes))
+	if len(found) == 0 {
+		return reports, nil
+	}
+
+	names := []models.FileName{}
+	if err := db.Select(&names, "SELECT id, file_id, name FROM file_names WHERE file_id = ANY($1) ORDER BY name", pq.Array(found)); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		byID[name.FileID].Names = append(byID[name.FileID].Names, name)
+	}
+
+	results := []models.FileAnalysisResult{}
+	if err := db.Select(&results, "SELECT id, file_id, engine_name, category, result, method FROM file_analysis_results WHERE file_id = ANY($1) ORDER BY engine_name", pq.Array(found)); err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		byID[result.FileID].AnalysisResults = append(byID[result.FileID].AnalysisResults, result)
+	}
+
+	for _, report := range byID {
+		for _, hash := range []*string{&report.File.ID, report.File.SHA1, report.File.MD5} {
+			if hash != nil && *hash != "" {
+				reports[*hash] = report
+			}
+		}
+	}
+	return reports, nil
+}
@@ -1,13 +1,16 @@
 package repositories
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"time"
 
 	"vt-data-pipeline/models"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // GetFromCache retrieves domain data from cache
@@ -30,6 +33,65 @@ func GetDomain(id string, db *sqlx.DB) (*models.Domain, error) {
 	return &domain, nil
 }
 
+// GetDomainCategories retrieves the engine categories of a domain
+func GetDomainCategories(id string, db *sqlx.DB) ([]models.DomainCategory, error) {
+	categories := []models.DomainCategory{}
+	err := db.Select(&categories, "SELECT id, domain_id, engine_name, category FROM domain_categories WHERE domain_id=$1 ORDER BY engine_name", id)
+	if err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// GetDomainAnalysisResults retrieves the per-engine analysis results of a domain
+func GetDomainAnalysisResults(id string, db *sqlx.DB) ([]models.DomainAnalysisResult, error) {
+	results := []models.DomainAnalysisResult{}
+	err := db.Select(&results, "SELECT id, domain_id, engine_name, category, result, method FROM domain_analysis_results WHERE domain_id=$1 ORDER BY engine_name", id)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// GetDomainDetails retrieves the DNS, certificate, RDAP and WHOIS details of a domain
+func GetDomainDetails(id string, db *sqlx.DB) (*models.DomainDetails, error) {
+	var details models.DomainDetails
+	err := db.Get(&details, `SELECT id, domain_id, last_dns_records, last_https_certificate, rdap, COALESCE(whois, '') AS whois, popularity_ranks, total_votes
+                          FROM domain_details WHERE domain_id=$1`, id)
+	if err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// GetDomainReport assembles the domain report from the domain tables, loading only the requested sections
+func GetDomainReport(id string, sections models.ReportSections, db *sqlx.DB) (*models.DomainReport, error) {
+	domain, err := GetDomain(id, db)
+	if err != nil {
+		return nil, err
+	}
+	report := &models.DomainReport{Domain: domain}
+
+	if sections.Has(models.SectionCategories) {
+		if report.Categories, err = GetDomainCategories(id, db); err != nil {
+			return nil, err
+		}
+	}
+	if sections.Has(models.SectionAnalysisResults) {
+		if report.AnalysisResults, err = GetDomainAnalysisResults(id, db); err != nil {
+			return nil, err
+		}
+	}
+	if sections.Has(models.SectionDetails) {
+		details, err := GetDomainDetails(id, db)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		report.Details = details
+	}
+	return report, nil
+}
+
 // SaveDomain saves or updates domain data
 func SaveDomain(tx *sqlx.Tx, domain *models.Domain) error {
 	_, err := tx.NamedExec(`INSERT INTO domains (id, type, creation_date, expiration_date, last_analysis_date, reputation, registrar, tld, whois_date, harmless_count, malicious_count, suspicious_count, undetected_count, timeout_count, created_at, updated_at)
@@ -52,65 +114,58 @@ func SaveDomain(tx *sqlx.Tx, domain *models.Domain) error {
 	return err
 }
 
-// SaveCategories saves domain categories
+// SaveDomainCategories replaces the categories of a domain, streaming the rows with COPY
 func SaveDomainCategories(tx *sqlx.Tx, domainID string, categories map[string]string) error {
 	// Clear existing categories
 	_, err := tx.Exec("DELETE FROM domain_categories WHERE domain_id=$1", domainID)
 	if err != nil {
 		return err
 	}
+	if len(categories) == 0 {
+		return nil
+	}
 
-	// Prepare the insert statement
-	stmt, err := tx.Prepare(`INSERT INTO domain_categories (domain_id, engine_name, category)
-                          VALUES ($1, $2, $3)`)
+	stmt, err := tx.Prepare(pq.CopyIn("domain_categories", "domain_id", "engine_name", "category"))
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	// Insert new categories
 	for engine, category := range categories {
-		_, err = stmt.Exec(domainID, engine, category)
-		if err != nil {
+		if _, err := stmt.Exec(domainID, engine, category); err != nil {
 			return err
 		}
 	}
-	return nil
+	// Flush the COPY buffer
+	_, err = stmt.Exec()
+	return err
 }
 
-// SaveAnalysisResults saves domain analysis results
-func SaveDomainAnalysisResults(tx *sqlx.Tx, domainID string, results map[string]struct {
-	Category string `json:"category"`
-	Result   string `json:"result"`
-	Method   string `json:"method"`
-}) error {
+// SaveDomainAnalysisResults replaces the analysis results of a domain, streaming the rows with COPY
+func SaveDomainAnalysisResults(tx *sqlx.Tx, domainID string, results map[string]models.EngineResult) error {
 	// Clear existing results
 	_, err := tx.Exec("DELETE FROM domain_analysis_results WHERE domain_id=$1", domainID)
 	if err != nil {
 		return err
 	}
+	if len(results) == 0 {
+		return nil
+	}
 
-	// Prepare the insert statement
-	stmt, err := tx.Prepare(`INSERT INTO domain_analysis_results (domain_id, engine_name, category, result, method)
-                          VALUES ($1, $2, $3, $4, $5)`)
+	stmt, err := tx.Prepare(pq.CopyIn("domain_analysis_results", "domain_id", "engine_name", "category", "result", "method"))
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	// Insert new results
 	for engine, result := range results {
-		_, err = stmt.Exec(
-			domainID,
-			engine,
-			result.Category,
-			result.Result,
-			result.Method)
-		if err != nil {
+		if _, err := stmt.Exec(domainID, engine, result.Category, result.Result, result.Method); err != nil {
 			return err
 		}
 	}
-	return nil
+	// Flush the COPY buffer
+	_, err = stmt.Exec()
+	return err
 }
 
 // SaveDetails saves domain details
@@ -193,3 +248,59 @@ func SaveDomainCache(tx *sqlx.Tx, id string, data any, expiration time.Duration)
 
 	return nil
 }
+
+// DomainSortOrder is a keyset order of GET /domains: rows are ordered by Key, then by id
+type DomainSortOrder struct {
+	Key     string // SQL expression, NULLs are replaced so they sort last. Each has a matching (Key, id) index in db/domain.sql.
+	KeyType string // Postgres type the cursor key is cast back to
+	Desc    bool
+}
+
+// DomainSortOrders maps the sort values of GET /domains to keyset orders, a leading - sorts descending
+var DomainSortOrders = map[string]DomainSortOrder{
+	"id":                  {Key: "d.id", KeyType: "text"},
+	"creation_date":       {Key: "COALESCE(d.creation_date, 'infinity'::timestamp)", KeyType: "timestamp"},
+	"-creation_date":      {Key: "COALESCE(d.creation_date, '-infinity'::timestamp)", KeyType: "timestamp", Desc: true},
+	"expiration_date":     {Key: "COALESCE(d.expiration_date, 'infinity'::timestamp)", KeyType: "timestamp"},
+	"-expiration_date":    {Key: "COALESCE(d.expiration_date, '-infinity'::timestamp)", KeyType: "timestamp", Desc: true},
+	"last_analysis_date":  {Key: "COALESCE(d.last_analysis_date, 'infinity'::timestamp)", KeyType: "timestamp"},
+	"-last_analysis_date": {Key: "COALESCE(d.last_analysis_date, '-infinity'::timestamp)", KeyType: "timestamp", Desc: true},
+	"reputation":          {Key: "COALESCE(d.reputation, 2147483647)", KeyType: "integer"},
+	"-reputation":         {Key: "COALESCE(d.reputation, -2147483648)", KeyType: "integer", Desc: true},
+}
+
+// SearchDomains retrieves stored domains matching the search, after the cursor row if one is given.
+// The WHOIS match uses the GIN full-text index on domain_details.whois.
+func SearchDomains(search models.DomainSearch, db *sqlx.DB) ([]models.DomainSearchResult, error) {
+	order := DomainSortOrders[search.Sort]
+	op, direction := ">", "ASC"
+	if order.Desc {
+		op, direction = "<", "DESC"
+	}
+
+	domains := []models.DomainSearchResult{}
+	err := db.Select(&domains, `SELECT d.*, `+order.Key+`::text AS sort_key FROM domains d
+                          WHERE ($1 = '' OR d.tld = $1)
+                          AND ($2 = '' OR lower(d.registrar) = lower($2))
+                          AND ($3::timestamp IS NULL OR d.creation_date >= $3)
+                          AND ($4::timestamp IS NULL OR d.creation_date < $4)
+                          AND ($5::timestamp IS NULL OR d.expiration_date >= $5)
+                          AND ($6::timestamp IS NULL OR d.expiration_date < $6)
+                          AND ($7::integer IS NULL OR d.reputation >= $7)
+                          AND ($8::integer IS NULL OR d.reputation <= $8)
+                          AND ($9::integer IS NULL OR d.malicious_count >= $9)
+                          AND ($10 = '' OR EXISTS (SELECT 1 FROM domain_categories dc
+                              WHERE dc.domain_id = d.id AND lower(dc.category) = lower($10)))
+                          AND ($11 = '' OR EXISTS (SELECT 1 FROM domain_details dd
+                              WHERE dd.domain_id = d.id AND to_tsvector('simple', COALESCE(dd.whois, '')) @@ websearch_to_tsquery('simple', $11)))
+                          AND ($12::text IS NULL OR (`+order.Key+`, d.id) `+op+` ($12::`+order.KeyType+`, $13))
+                          ORDER BY `+order.Key+` `+direction+`, d.id `+direction+`
+                          LIMIT $14`,
+		search.TLD, search.Registrar, search.CreatedAfter, search.CreatedBefore, search.ExpiresAfter, search.ExpiresBefore,
+		search.MinReputation, search.MaxReputation, search.MinMalicious, search.Category, search.Whois,
+		search.AfterKey, search.AfterID, search.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"vt-data-pipeline/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// GetFile retrieves file data from the main table by its SHA-256, SHA-1 or MD5
+func GetFile(hash string, db *sqlx.DB) (*models.File, error) {
+	var file models.File
+	err := db.Get(&file, "SELECT * FROM files WHERE id=$1 OR sha1=$1 OR md5=$1 LIMIT 1", hash)
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetFileNames retrieves the submitted names of a file
+func GetFileNames(id string, db *sqlx.DB) ([]models.FileName, error) {
+	names := []models.FileName{}
+	err := db.Select(&names, "SELECT id, file_id, name FROM file_names WHERE file_id=$1 ORDER BY name", id)
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// GetFileAnalysisResults retrieves the per-engine analysis results of a file
+func GetFileAnalysisResults(id string, db *sqlx.DB) ([]models.FileAnalysisResult, error) {
+	results := []models.FileAnalysisResult{}
+	err := db.Select(&results, "SELECT id, file_id, engine_name, category, result, method FROM file_analysis_results WHERE file_id=$1 ORDER BY engine_name", id)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// GetFileReport assembles the file report from the file tables, loading only the requested sections
+func GetFileReport(hash string, sections models.ReportSections, db *sqlx.DB) (*models.FileReport, error) {
+	file, err := GetFile(hash, db)
+	if err != nil {
+		return nil, err
+	}
+	report := &models.FileReport{File: file}
+
+	if sections.Has(models.SectionNames) {
+		if report.Names, err = GetFileNames(file.ID, db); err != nil {
+			return nil, err
+		}
+	}
+	if sections.Has(models.SectionAnalysisResults) {
+		if report.AnalysisResults, err = GetFileAnalysisResults(file.ID, db); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// SaveFile saves or updates file data
+func SaveFile(tx *sqlx.Tx, file *models.File) error {
+	_, err := tx.NamedExec(`INSERT INTO files (id, type, md5, sha1, size, type_description, type_tag, meaningful_name, magic, first_submission_date, last_submission_date, last_analysis_date, times_submitted, reputation, signature_info, last_analysis_stats, harmless_count, malicious_count, suspicious_count, undetected_count, timeout_count, created_at, updated_at)
+                          VALUES (:id, :type, :md5, :sha1, :size, :type_description, :type_tag, :meaningful_name, :magic, :first_submission_date, :last_submission_date, :last_analysis_date, :times_submitted, :reputation, :signature_info, :last_analysis_stats, :harmless_count, :malicious_count, :suspicious_count, :undetected_count, :timeout_count, :created_at, :updated_at)
+                          ON CONFLICT (id) DO UPDATE SET
+                          type = EXCLUDED.type,
+                          md5 = EXCLUDED.md5,
+                          sha1 = EXCLUDED.sha1,
+                          size = EXCLUDED.size,
+                          type_description = EXCLUDED.type_description,
+                          type_tag = EXCLUDED.type_tag,
+                          meaningful_name = EXCLUDED.meaningful_name,
+                          magic = EXCLUDED.magic,
+                          first_submission_date = EXCLUDED.first_submission_date,
+                          last_submission_date = EXCLUDED.last_submission_date,
+                          last_analysis_date = EXCLUDED.last_analysis_date,
+                          times_submitted = EXCLUDED.times_submitted,
+                          reputation = EXCLUDED.reputation,
+                          signature_info = EXCLUDED.signature_info,
+                          last_analysis_stats = EXCLUDED.last_analysis_stats,
+                          harmless_count = EXCLUDED.harmless_count,
+                          malicious_count = EXCLUDED.malicious_count,
+                          suspicious_count = EXCLUDED.suspicious_count,
+                          undetected_count = EXCLUDED.undetected_count,
+                          timeout_count = EXCLUDED.timeout_count,
+                          updated_at = EXCLUDED.updated_at`, file)
+	return err
+}
+
+// SaveFileNames replaces the submitted names of a file, streaming the rows with COPY
+func SaveFileNames(tx *sqlx.Tx, fileID string, names []string) error {
+	// Clear existing names
+	_, err := tx.Exec("DELETE FROM file_names WHERE file_id=$1", fileID)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("file_names", "file_id", "name"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	// COPY does not support ON CONFLICT, so drop duplicates that would violate UNIQUE (file_id, name)
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if _, err := stmt.Exec(fileID, name); err != nil {
+			return err
+		}
+	}
+	// Flush the COPY buffer
+	_, err = stmt.Exec()
+	return err
+}
+
+// SaveFileAnalysisResults replaces the analysis results of a file, streaming the rows with COPY
+func SaveFileAnalysisResults(tx *sqlx.Tx, fileID string, results map[string]models.EngineResult) error {
+	// Clear existing results
+	_, err := tx.Exec("DELETE FROM file_analysis_results WHERE file_id=$1", fileID)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("file_analysis_results", "file_id", "engine_name", "category", "result", "method"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for engine, result := range results {
+		if _, err := stmt.Exec(fileID, engine, result.Category, result.Result, result.Method); err != nil {
+			return err
+		}
+	}
+	// Flush the COPY buffer
+	_, err = stmt.Exec()
+	return err
+}
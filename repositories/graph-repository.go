@@ -0,0 +1,79 @@
+package repositories
+
+import (
+	"encoding/json"
+
+	"vt-data-pipeline/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// GetDomainsResolvingTo retrieves domains whose last DNS records hold an A or AAAA record for the IP
+func GetDomainsResolvingTo(ip string, limit int, db *sqlx.DB) ([]string, error) {
+	a, _ := json.Marshal([]models.DNSRecord{{Type: "A", Value: ip}})
+	aaaa, _ := json.Marshal([]models.DNSRecord{{Type: "AAAA", Value: ip}})
+
+	ids := []string{}
+	err := db.Select(&ids, `SELECT domain_id FROM domain_details
+                          WHERE last_dns_records @> $1::jsonb OR last_dns_records @> $2::jsonb
+                          ORDER BY domain_id LIMIT $3`, string(a), string(aaaa), limit)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetIPsInNetwork retrieves stored IPs announced in the given network
+func GetIPsInNetwork(network string, limit int, db *sqlx.DB) ([]string, error) {
+	ids := []string{}
+	err := db.Select(&ids, "SELECT id FROM ip_addresses WHERE network=$1 ORDER BY id LIMIT $2", network, limit)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetIPsByASN retrieves stored IPs announced by the given autonomous system
+func GetIPsByASN(asn int, limit int, db *sqlx.DB) ([]string, error) {
+	ids := []string{}
+	err := db.Select(&ids, "SELECT id FROM ip_addresses WHERE asn=$1 ORDER BY id LIMIT $2", asn, limit)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetDomainsByRegistrar retrieves stored domains registered with the given registrar
+func GetDomainsByRegistrar(registrar string, limit int, db *sqlx.DB) ([]string, error) {
+	ids := []string{}
+	err := db.Select(&ids, "SELECT id FROM domains WHERE registrar=$1 ORDER BY id LIMIT $2", registrar, limit)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetDomainsByCertificate retrieves stored domains serving the certificate with the given SHA-256 thumbprint
+func GetDomainsByCertificate(thumbprint string, limit int, db *sqlx.DB) ([]string, error) {
+	ids := []string{}
+	err := db.Select(&ids, `SELECT domain_id FROM domain_details
+                          WHERE last_https_certificate->>'thumbprint_sha256' = $1
+                          ORDER BY domain_id LIMIT $2`, thumbprint, limit)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetRelationshipsTouching retrieves stored relationship edges where the indicator is the source or the target
+func GetRelationshipsTouching(indicatorType, id string, limit int, db *sqlx.DB) ([]models.Relationship, error) {
+	edges := []models.Relationship{}
+	err := db.Select(&edges, `SELECT id, source_type, source_id, relation, target_type, target_id, first_seen, last_seen
+                          FROM relationships
+                          WHERE (source_type=$1 AND source_id=$2) OR (target_type=$1 AND target_id=$2)
+                          ORDER BY last_seen DESC NULLS LAST LIMIT $3`, indicatorType, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	return edges, nil
+}
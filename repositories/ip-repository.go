@@ -1,13 +1,16 @@
 package repositories
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"time"
 
 	"vt-data-pipeline/models"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // GetFromCache retrieves IP data from cache (shared with domains)
@@ -30,6 +33,64 @@ func GetIPAddress(id string, db *sqlx.DB) (*models.IPAddress, error) {
 	return &ip, nil
 }
 
+// GetIPTags retrieves the tags of an IP address
+func GetIPTags(id string, db *sqlx.DB) ([]models.IPTag, error) {
+	tags := []models.IPTag{}
+	err := db.Select(&tags, "SELECT id, ip_id, tag FROM ip_tags WHERE ip_id=$1 ORDER BY tag", id)
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// GetIPAnalysisResults retrieves the per-engine analysis results of an IP address
+func GetIPAnalysisResults(id string, db *sqlx.DB) ([]models.IPAnalysisResult, error) {
+	results := []models.IPAnalysisResult{}
+	err := db.Select(&results, "SELECT id, ip_id, engine_name, category, result, method FROM ip_analysis_results WHERE ip_id=$1 ORDER BY engine_name", id)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// GetIPDetails retrieves the WHOIS and vote details of an IP address
+func GetIPDetails(id string, db *sqlx.DB) (*models.IPDetails, error) {
+	var details models.IPDetails
+	err := db.Get(&details, "SELECT id, ip_id, COALESCE(whois, '') AS whois, total_votes FROM ip_details WHERE ip_id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// GetIPReport assembles the IP report from the IP tables, loading only the requested sections
+func GetIPReport(id string, sections models.ReportSections, db *sqlx.DB) (*models.IPReport, error) {
+	ip, err := GetIPAddress(id, db)
+	if err != nil {
+		return nil, err
+	}
+	report := &models.IPReport{IP: ip}
+
+	if sections.Has(models.SectionTags) {
+		if report.Tags, err = GetIPTags(id, db); err != nil {
+			return nil, err
+		}
+	}
+	if sections.Has(models.SectionAnalysisResults) {
+		if report.AnalysisResults, err = GetIPAnalysisResults(id, db); err != nil {
+			return nil, err
+		}
+	}
+	if sections.Has(models.SectionDetails) {
+		details, err := GetIPDetails(id, db)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		report.Details = details
+	}
+	return report, nil
+}
+
 // SaveIPAddress saves or updates IP data
 func SaveIPAddress(tx *sqlx.Tx, ip *models.IPAddress) error {
 	_, err := tx.NamedExec(`INSERT INTO ip_addresses (id, type, last_analysis_date, asn, reputation, country, as_owner, regional_internet_registry, network, whois_date, last_modification_date, continent, harmless_count, malicious_count, suspicious_count, undetected_count, timeout_count, created_at, updated_at)
@@ -55,65 +116,64 @@ func SaveIPAddress(tx *sqlx.Tx, ip *models.IPAddress) error {
 	return err
 }
 
-// SaveTags saves IP tags
+// SaveIPTags replaces the tags of an IP address, streaming the rows with COPY
 func SaveIPTags(tx *sqlx.Tx, ipID string, tags []string) error {
 	// Clear existing tags
 	_, err := tx.Exec("DELETE FROM ip_tags WHERE ip_id=$1", ipID)
 	if err != nil {
 		return err
 	}
+	if len(tags) == 0 {
+		return nil
+	}
 
-	// Prepare the insert statement
-	stmt, err := tx.Prepare(`INSERT INTO ip_tags (ip_id, tag)
-                          VALUES ($1, $2)`)
+	stmt, err := tx.Prepare(pq.CopyIn("ip_tags", "ip_id", "tag"))
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	// Insert new tags
+	// COPY does not support ON CONFLICT, so drop duplicates that would violate UNIQUE (ip_id, tag)
+	seen := make(map[string]bool, len(tags))
 	for _, tag := range tags {
-		_, err = stmt.Exec(ipID, tag)
-		if err != nil {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		if _, err := stmt.Exec(ipID, tag); err != nil {
 			return err
 		}
 	}
-	return nil
+	// Flush the COPY buffer
+	_, err = stmt.Exec()
+	return err
 }
 
-// SaveAnalysisResults saves IP analysis results
-func SaveIPAnalysisResults(tx *sqlx.Tx, ipID string, results map[string]struct {
-	Category string `json:"category"`
-	Result   string `json:"result"`
-	Method   string `json:"method"`
-}) error {
+// SaveIPAnalysisResults replaces the analysis results of an IP address, streaming the rows with COPY
+func SaveIPAnalysisResults(tx *sqlx.Tx, ipID string, results map[string]models.EngineResult) error {
 	// Clear existing results
 	_, err := tx.Exec("DELETE FROM ip_analysis_results WHERE ip_id=$1", ipID)
 	if err != nil {
 		return err
 	}
+	if len(results) == 0 {
+		return nil
+	}
 
-	// Prepare the insert statement
-	stmt, err := tx.Prepare(`INSERT INTO ip_analysis_results (ip_id, engine_name, category, result, method)
-                          VALUES ($1, $2, $3, $4, $5)`)
+	stmt, err := tx.Prepare(pq.CopyIn("ip_analysis_results", "ip_id", "engine_name", "category", "result", "method"))
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	// Insert new results
 	for engine, result := range results {
-		_, err = stmt.Exec(
-			ipID,
-			engine,
-			result.Category,
-			result.Result,
-			result.Method)
-		if err != nil {
+		if _, err := stmt.Exec(ipID, engine, result.Category, result.Result, result.Method); err != nil {
 			return err
 		}
 	}
-	return nil
+	// Flush the COPY buffer
+	_, err = stmt.Exec()
+	return err
 }
 
 // SaveDetails saves IP details
@@ -192,3 +252,33 @@ func SaveIPReportCache(tx *sqlx.Tx, id string, data any, expiration time.Duratio
 
 	return nil
 }
+
+// IPSortOrders maps the sort values of GET /ips to ORDER BY clauses, a leading - sorts descending
+var IPSortOrders = map[string]string{
+	"reputation":          "reputation ASC NULLS LAST, id",
+	"-reputation":         "reputation DESC NULLS LAST, id",
+	"last_analysis_date":  "last_analysis_date ASC NULLS LAST, id",
+	"-last_analysis_date": "last_analysis_date DESC NULLS LAST, id",
+}
+
+// SearchIPAddresses retrieves stored IPs matching the search, the CIDR filter uses the GiST index on address
+func SearchIPAddresses(search models.IPSearch, db *sqlx.DB) ([]models.IPAddress, error) {
+	var cidr *string
+	if search.CIDR != nil {
+		s := search.CIDR.String()
+		cidr = &s
+	}
+
+	ips := []models.IPAddress{}
+	err := db.Select(&ips, `SELECT * FROM ip_addresses
+                          WHERE ($1::inet IS NULL OR address <<= $1::inet)
+                          AND ($2::integer IS NULL OR asn = $2)
+                          AND ($3 = '' OR country = $3)
+                          AND ($4::integer IS NULL OR malicious_count >= $4)
+                          ORDER BY `+IPSortOrders[search.Sort]+`
+                          LIMIT $5 OFFSET $6`, cidr, search.ASN, search.Country, search.MinMalicious, search.Limit, search.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return ips, nil
+}
@@ -0,0 +1,42 @@
+package repositories
+
+import (
+	"time"
+
+	"vt-data-pipeline/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SaveNotFoundIndicator records a NotFoundError from VirusTotal, extending the entry to ttl from now
+func SaveNotFoundIndicator(indicator, reportType string, ttl time.Duration, db *sqlx.DB) (*models.NotFoundIndicator, error) {
+	var entry models.NotFoundIndicator
+	err := db.Get(&entry, `INSERT INTO not_found_indicators (indicator, type, expires_at)
+                          VALUES ($1, $2, NOW() + $3 * INTERVAL '1 second')
+                          ON CONFLICT (indicator, type) DO UPDATE SET
+                          last_seen_at = NOW(),
+                          not_found_count = not_found_indicators.not_found_count + 1,
+                          expires_at = EXCLUDED.expires_at
+                          RETURNING *`, indicator, reportType, int(ttl.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// GetNotFoundIndicator retrieves an unexpired entry, or sql.ErrNoRows
+func GetNotFoundIndicator(indicator, reportType string, db *sqlx.DB) (*models.NotFoundIndicator, error) {
+	var entry models.NotFoundIndicator
+	err := db.Get(&entry, "SELECT * FROM not_found_indicators WHERE indicator=$1 AND type=$2 AND expires_at > NOW()", indicator, reportType)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// CountNotFoundIndicators counts the unexpired entries
+func CountNotFoundIndicators(db *sqlx.DB) (int, error) {
+	var count int
+	err := db.Get(&count, "SELECT COUNT(*) FROM not_found_indicators WHERE expires_at > NOW()")
+	return count, err
+}
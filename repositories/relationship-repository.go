@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"time"
+
+	"vt-data-pipeline/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// GetRelationshipFetch retrieves when a relationship of an indicator was last ingested
+func GetRelationshipFetch(sourceType, sourceID, relation string, db *sqlx.DB) (*models.RelationshipFetch, error) {
+	var fetch models.RelationshipFetch
+	err := db.Get(&fetch, "SELECT source_type, source_id, relation, fetched_at FROM relationship_fetches WHERE source_type=$1 AND source_id=$2 AND relation=$3", sourceType, sourceID, relation)
+	if err != nil {
+		return nil, err
+	}
+	return &fetch, nil
+}
+
+// GetRelationships retrieves the edges of one relationship of an indicator, most recently seen first
+func GetRelationships(sourceType, sourceID, relation string, limit, offset int, db *sqlx.DB) ([]models.Relationship, error) {
+	edges := []models.Relationship{}
+	err := db.Select(&edges, `SELECT id, source_type, source_id, relation, target_type, target_id, first_seen, last_seen
+                          FROM relationships
+                          WHERE source_type=$1 AND source_id=$2 AND relation=$3
+                          ORDER BY last_seen DESC NULLS LAST, target_id
+                          LIMIT $4 OFFSET $5`, sourceType, sourceID, relation, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return edges, nil
+}
+
+// SaveRelationships upserts edges in a single statement, widening first_seen/last_seen of existing edges
+func SaveRelationships(tx *sqlx.Tx, edges []models.Relationship) error {
+	if len(edges) == 0 {
+		return nil
+	}
+
+	n := len(edges)
+	sourceTypes, sourceIDs, relations := make([]string, n), make([]string, n), make([]string, n)
+	targetTypes, targetIDs := make([]string, n), make([]string, n)
+	firstSeen, lastSeen := make([]*time.Time, n), make([]*time.Time, n)
+	for i, e := range edges {
+		sourceTypes[i], sourceIDs[i], relations[i] = e.SourceType, e.SourceID, e.Relation
+		targetTypes[i], targetIDs[i] = e.TargetType, e.TargetID
+		firstSeen[i], lastSeen[i] = e.FirstSeen, e.LastSeen
+	}
+
+	_, err := tx.Exec(`INSERT INTO relationships (source_type, source_id, relation, target_type, target_id, first_seen, last_seen)
+                          SELECT * FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::text[], $6::timestamp[], $7::timestamp[])
+                          ON CONFLICT (source_type, source_id, relation, target_type, target_id) DO UPDATE SET
+                          first_seen = LEAST(relationships.first_seen, EXCLUDED.first_seen),
+                          last_seen = GREATEST(relationships.last_seen, EXCLUDED.last_seen)`,
+		pq.Array(sourceTypes), pq.Array(sourceIDs), pq.Array(relations),
+		pq.Array(targetTypes), pq.Array(targetIDs), pq.Array(firstSeen), pq.Array(lastSeen))
+	return err
+}
+
+// SaveRelationshipFetch records that a relationship of an indicator was just ingested
+func SaveRelationshipFetch(tx *sqlx.Tx, sourceType, sourceID, relation string) error {
+	_, err := tx.Exec(`INSERT INTO relationship_fetches (source_type, source_id, relation, fetched_at)
+                          VALUES ($1, $2, $3, $4)
+                          ON CONFLICT (source_type, source_id, relation) DO UPDATE SET
+                          fetched_at = EXCLUDED.fetched_at`, sourceType, sourceID, relation, time.Now())
+	return err
+}
@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"time"
+
+	"vt-data-pipeline/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SaveDomainSnapshot appends a snapshot to the domain history
+func SaveDomainSnapshot(tx *sqlx.Tx, snapshot *models.DomainSnapshot) error {
+	_, err := tx.NamedExec(`INSERT INTO domain_snapshots (domain_id, fetched_at, last_analysis_date, reputation, harmless_count, malicious_count, suspicious_count, undetected_count, timeout_count, verdicts, dns_records, certificate_thumbprint, response_hash)
+                          VALUES (:domain_id, :fetched_at, :last_analysis_date, :reputation, :harmless_count, :malicious_count, :suspicious_count, :undetected_count, :timeout_count, :verdicts, :dns_records, :certificate_thumbprint, :response_hash)`, snapshot)
+	return err
+}
+
+// GetDomainSnapshots retrieves the domain history fetched within [from, to], newest first
+func GetDomainSnapshots(id string, from, to time.Time, limit int, db *sqlx.DB) ([]models.DomainSnapshot, error) {
+	snapshots := []models.DomainSnapshot{}
+	err := db.Select(&snapshots, `SELECT * FROM domain_snapshots
+                          WHERE domain_id=$1 AND fetched_at >= $2 AND fetched_at <= $3
+                          ORDER BY fetched_at DESC LIMIT $4`, id, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// GetDomainSnapshotAt retrieves the domain snapshot in effect at the given time.
+// When the domain was first fetched after that time, its earliest snapshot is returned instead.
+func GetDomainSnapshotAt(id string, at time.Time, db *sqlx.DB) (*models.DomainSnapshot, error) {
+	var snapshot models.DomainSnapshot
+	err := db.Get(&snapshot, `SELECT * FROM domain_snapshots WHERE domain_id=$1
+                          ORDER BY fetched_at <= $2 DESC, CASE WHEN fetched_at <= $2 THEN fetched_at END DESC, fetched_at ASC
+                          LIMIT 1`, id, at)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// GetDomainSnapshot retrieves a domain snapshot by its ID
+func GetDomainSnapshot(snapshotID int64, db *sqlx.DB) (*models.DomainSnapshot, error) {
+	var snapshot models.DomainSnapshot
+	if err := db.Get(&snapshot, "SELECT * FROM domain_snapshots WHERE id=$1", snapshotID); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// SaveIPSnapshot appends a snapshot to the IP history
+func SaveIPSnapshot(tx *sqlx.Tx, snapshot *models.IPSnapshot) error {
+	_, err := tx.NamedExec(`INSERT INTO ip_snapshots (ip_id, fetched_at, last_analysis_date, reputation, harmless_count, malicious_count, suspicious_count, undetected_count, timeout_count, verdicts, tags, response_hash)
+                          VALUES (:ip_id, :fetched_at, :last_analysis_date, :reputation, :harmless_count, :malicious_count, :suspicious_count, :undetected_count, :timeout_count, :verdicts, :tags, :response_hash)`, snapshot)
+	return err
+}
+
+// GetIPSnapshots retrieves the IP history fetched within [from, to], newest first
+func GetIPSnapshots(id string, from, to time.Time, limit int, db *sqlx.DB) ([]models.IPSnapshot, error) {
+	snapshots := []models.IPSnapshot{}
+	err := db.Select(&snapshots, `SELECT * FROM ip_snapshots
+                          WHERE ip_id=$1 AND fetched_at >= $2 AND fetched_at <= $3
+                          ORDER BY fetched_at DESC LIMIT $4`, id, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// GetIPSnapshotAt retrieves the IP snapshot in effect at the given time.
+// When the IP was first fetched after that time, its earliest snapshot is returned instead.
+func GetIPSnapshotAt(id string, at time.Time, db *sqlx.DB) (*models.IPSnapshot, error) {
+	var snapshot models.IPSnapshot
+	err := db.Get(&snapshot, `SELECT * FROM ip_snapshots WHERE ip_id=$1
+                          ORDER BY fetched_at <= $2 DESC, CASE WHEN fetched_at <= $2 THEN fetched_at END DESC, fetched_at ASC
+                          LIMIT 1`, id, at)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// GetIPSnapshot retrieves an IP snapshot by its ID
+func GetIPSnapshot(snapshotID int64, db *sqlx.DB) (*models.IPSnapshot, error) {
+	var snapshot models.IPSnapshot
+	if err := db.Get(&snapshot, "SELECT * FROM ip_snapshots WHERE id=$1", snapshotID); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+
+	"vt-data-pipeline/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// GetURL retrieves URL data from the main table
+func GetURL(id string, db *sqlx.DB) (*models.URL, error) {
+	var url models.URL
+	err := db.Get(&url, "SELECT * FROM urls WHERE id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+	return &url, nil
+}
+
+// GetURLAnalysisResults retrieves the per-engine analysis results of a URL
+func GetURLAnalysisResults(id string, db *sqlx.DB) ([]models.URLAnalysisResult, error) {
+	results := []models.URLAnalysisResult{}
+	err := db.Select(&results, "SELECT id, url_id, engine_name, category, result, method FROM url_analysis_results WHERE url_id=$1 ORDER BY engine_name", id)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// GetURLDetails retrieves the categories, redirects and HTTP response details of a URL
+func GetURLDetails(id string, db *sqlx.DB) (*models.URLDetails, error) {
+	var details models.URLDetails
+	err := db.Get(&details, `SELECT id, url_id, categories, tags, threat_names, redirection_chain, last_http_response_headers, outgoing_links, html_meta, total_votes
+                          FROM url_details WHERE url_id=$1`, id)
+	if err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// GetURLReport assembles the URL report from the URL tables, loading only the requested sections
+func GetURLReport(id string, sections models.ReportSections, db *sqlx.DB) (*models.URLReport, error) {
+	url, err := GetURL(id, db)
+	if err != nil {
+		return nil, err
+	}
+	report := &models.URLReport{URL: url}
+
+	if sections.Has(models.SectionAnalysisResults) {
+		if report.AnalysisResults, err = GetURLAnalysisResults(id, db); err != nil {
+			return nil, err
+		}
+	}
+	if sections.Has(models.SectionDetails) {
+		details, err := GetURLDetails(id, db)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		report.Details = details
+	}
+	return report, nil
+}
+
+// SaveURL saves or updates URL data
+func SaveURL(tx *sqlx.Tx, url *models.URL) error {
+	_, err := tx.NamedExec(`INSERT INTO urls (id, type, url, last_final_url, title, first_submission_date, last_submission_date, last_analysis_date, reputation, times_submitted, last_http_response_code, harmless_count, malicious_count, suspicious_count, undetected_count, timeout_count, created_at, updated_at)
+                          VALUES (:id, :type, :url, :last_final_url, :title, :first_submission_date, :last_submission_date, :last_analysis_date, :reputation, :times_submitted, :last_http_response_code, :harmless_count, :malicious_count, :suspicious_count, :undetected_count, :timeout_count, :created_at, :updated_at)
+                          ON CONFLICT (id) DO UPDATE SET
+                          type = EXCLUDED.type,
+                          url = EXCLUDED.url,
+                          last_final_url = EXCLUDED.last_final_url,
+                          title = EXCLUDED.title,
+                          first_submission_date = EXCLUDED.first_submission_date,
+                          last_submission_date = EXCLUDED.last_submission_date,
+                          last_analysis_date = EXCLUDED.last_analysis_date,
+                          reputation = EXCLUDED.reputation,
+                          times_submitted = EXCLUDED.times_submitted,
+                          last_http_response_code = EXCLUDED.last_http_response_code,
+                          harmless_count = EXCLUDED.harmless_count,
+                          malicious_count = EXCLUDED.malicious_count,
+                          suspicious_count = EXCLUDED.suspicious_count,
+                          undetected_count = EXCLUDED.undetected_count,
+                          timeout_count = EXCLUDED.timeout_count,
+                          updated_at = EXCLUDED.updated_at`, url)
+	return err
+}
+
+// SaveURLAnalysisResults replaces the analysis results of a URL, streaming the rows with COPY
+func SaveURLAnalysisResults(tx *sqlx.Tx, urlID string, results map[string]models.EngineResult) error {
+	// Clear existing results
+	_, err := tx.Exec("DELETE FROM url_analysis_results WHERE url_id=$1", urlID)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("url_analysis_results", "url_id", "engine_name", "category", "result", "method"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for engine, result := range results {
+		if _, err := stmt.Exec(urlID, engine, result.Category, result.Result, result.Method); err != nil {
+			return err
+		}
+	}
+	// Flush the COPY buffer
+	_, err = stmt.Exec()
+	return err
+}
+
+// SaveURLDetails saves URL details
+func SaveURLDetails(tx *sqlx.Tx, details *models.URLDetails) error {
+	_, err := tx.NamedExec(`INSERT INTO url_details (url_id, categories, tags, threat_names, redirection_chain, last_http_response_headers, outgoing_links, html_meta, total_votes)
+                          VALUES (:url_id, :categories, :tags, :threat_names, :redirection_chain, :last_http_response_headers, :outgoing_links, :html_meta, :total_votes)
+                          ON CONFLICT (url_id) DO UPDATE SET
+                          categories = EXCLUDED.categories,
+                          tags = EXCLUDED.tags,
+                          threat_names = EXCLUDED.threat_names,
+                          redirection_chain = EXCLUDED.redirection_chain,
+                          last_http_response_headers = EXCLUDED.last_http_response_headers,
+                          outgoing_links = EXCLUDED.outgoing_links,
+                          html_meta = EXCLUDED.html_meta,
+                          total_votes = EXCLUDED.total_votes`, details)
+	return err
+}
@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"time"
+
+	"vt-data-pipeline/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SaveWatchlistEntry adds an indicator to the watchlist or updates its interval.
+// A new entry is due immediately, an existing one keeps its schedule.
+func SaveWatchlistEntry(indicator, reportType string, interval time.Duration, db *sqlx.DB) (*models.WatchlistEntry, error) {
+	var entry models.WatchlistEntry
+	err := db.Get(&entry, `INSERT INTO watchlist (indicator, type, refresh_interval_seconds)
+                          VALUES ($1, $2, $3)
+                          ON CONFLICT (indicator, type) DO UPDATE SET
+                          refresh_interval_seconds = EXCLUDED.refresh_interval_seconds
+                          RETURNING *`, indicator, reportType, int(interval.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// DeleteWatchlistEntry removes an indicator from the watchlist and reports whether it was watched
+func DeleteWatchlistEntry(indicator, reportType string, db *sqlx.DB) (bool, error) {
+	result, err := db.Exec("DELETE FROM watchlist WHERE indicator=$1 AND type=$2", indicator, reportType)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetWatchlist retrieves all watched indicators, soonest due first
+func GetWatchlist(db *sqlx.DB) ([]models.WatchlistEntry, error) {
+	entries := []models.WatchlistEntry{}
+	err := db.Select(&entries, "SELECT * FROM watchlist ORDER BY next_refresh_at, id")
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// GetDueWatchlistEntries retrieves up to limit due entries, highest priority first.
+// Priority is staleness relative to the entry's interval, scaled up by the malicious and suspicious counts;
+// indicators that were never fetched come first.
+func GetDueWatchlistEntries(limit int, db *sqlx.DB) ([]models.WatchlistEntry, error) {
+	entries := []models.WatchlistEntry{}
+	err := db.Select(&entries, `SELECT w.* FROM watchlist w
+                          LEFT JOIN domains d ON w.type = 'domains' AND d.id = w.indicator
+                          LEFT JOIN ip_addresses i ON w.type = 'ip_addresses' AND i.id = w.indicator
+                          WHERE w.next_refresh_at <= NOW()
+                          ORDER BY COALESCE(d.updated_at, i.updated_at) IS NULL DESC,
+                          EXTRACT(EPOCH FROM NOW() - COALESCE(d.updated_at, i.updated_at)) / w.refresh_interval_seconds
+                          * (1 + COALESCE(d.malicious_count, i.malicious_count, 0) + 0.5 * COALESCE(d.suspicious_count, i.suspicious_count, 0)) DESC
+                          LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// CountDueWatchlistEntries counts the entries waiting for a refresh
+func CountDueWatchlistEntries(db *sqlx.DB) (int, error) {
+	var count int
+	err := db.Get(&count, "SELECT COUNT(*) FROM watchlist WHERE next_refresh_at <= NOW()")
+	return count, err
+}
+
+// MarkWatchlistEnqueued schedules the next refresh of an entry one interval after now
+func MarkWatchlistEnqueued(id int, db *sqlx.DB) error {
+	_, err := db.Exec(`UPDATE watchlist SET last_enqueued_at = NOW(),
+                          next_refresh_at = NOW() + refresh_interval_seconds * INTERVAL '1 second'
+                          WHERE id=$1`, id)
+	return err
+}
+
+// AdvanceWatchlistBaseline moves the alert baseline of a watched indicator to snapshotID and returns the snapshot
+// it moved from, nil when the indicator was never evaluated. ok is false when the indicator is not watched or its
+// baseline is already at or past snapshotID, e.g. because a concurrent refresh evaluated it first.
+func AdvanceWatchlistBaseline(indicator, reportType string, snapshotID int64, db *sqlx.DB) (previous *int64, ok bool, err error) {
+	var rows []struct {
+		Previous *int64 `db:"previous"`
+	}
+	err = db.Select(&rows, `UPDATE watchlist w SET last_evaluated_snapshot_id = $3
+                          FROM (SELECT id, last_evaluated_snapshot_id AS previous FROM watchlist
+                              WHERE indicator=$1 AND type=$2 FOR UPDATE) p
+                          WHERE w.id = p.id AND (p.previous IS NULL OR p.previous < $3)
+                          RETURNING p.previous`, indicator, reportType, snapshotID)
+	if err != nil || len(rows) == 0 {
+		return nil, false, err
+	}
+	return rows[0].Previous, true, nil
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/repositories"
+	"vt-data-pipeline/webhook"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AlertThresholds are the changes between two snapshots that raise an alert
+type AlertThresholds struct {
+	MaliciousIncrease  int
+	SuspiciousIncrease int
+	ReputationDrop     int
+	EngineFlips        int
+}
+
+// AlertNotifier compares a refreshed watched indicator with the snapshot it was last evaluated at, stores an alert when a threshold
+// is crossed and posts it to the configured webhooks
+type AlertNotifier struct {
+	db            *sqlx.DB
+	thresholds    AlertThresholds
+	webhookURLs   []string
+	webhookClient *webhook.Client
+}
+
+// NewAlertNotifier creates a new AlertNotifier instance. Webhook payloads are signed with secret when it is set.
+func NewAlertNotifier(db *sqlx.DB, thresholds AlertThresholds, webhookURLs []string, secret string) *AlertNotifier {
+	return &AlertNotifier{
+		db:            db,
+		thresholds:    thresholds,
+		webhookURLs:   webhookURLs,
+		webhookClient: webhook.NewClient(secret),
+	}
+}
+
+// Evaluate diffs the latest snapshot of a watched domain or IP against the snapshot it was last evaluated at,
+// and returns the alert raised, or nil. Snapshots written in between by user lookups, batches or revalidations
+// do not move the baseline, so a change they saw first still raises an alert. The first evaluation of an entry
+// diffs against the previous snapshot.
+func (n *AlertNotifier) Evaluate(ctx context.Context, id, reportType string) (*models.Alert, error) {
+	var diff *models.ReportDiff
+	switch reportType {
+	case "domains":
+		snapshots, err := repositories.GetDomainSnapshots(id, time.Time{}, time.Now(), 2, n.db)
+		if err != nil || len(snapshots) == 0 {
+			return nil, err
+		}
+		baselineID, ok, err := repositories.AdvanceWatchlistBaseline(id, reportType, snapshots[0].ID, n.db)
+		if err != nil || !ok {
+			return nil, err
+		}
+		var before *models.DomainSnapshot
+		if baselineID != nil {
+			if before, err = repositories.GetDomainSnapshot(*baselineID, n.db); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return nil, err
+			}
+		}
+		if before == nil && len(snapshots) == 2 {
+			before = &snapshots[1]
+		}
+		if before == nil {
+			return nil, nil
+		}
+		if diff, err = diffDomainSnapshots(id, reportType, before, &snapshots[0]); err != nil {
+			return nil, err
+		}
+	case "ip_addresses":
+		snapshots, err := repositories.GetIPSnapshots(id, time.Time{}, time.Now(), 2, n.db)
+		if err != nil || len(snapshots) == 0 {
+			return nil, err
+		}
+		baselineID, ok, err := repositories.AdvanceWatchlistBaseline(id, reportType, snapshots[0].ID, n.db)
+		if err != nil || !ok {
+			return nil, err
+		}
+		var before *models.IPSnapshot
+		if baselineID != nil {
+			if before, err = repositories.GetIPSnapshot(*baselineID, n.db); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return nil, err
+			}
+		}
+		if before == nil && len(snapshots) == 2 {
+			before = &snapshots[1]
+		}
+		if before == nil {
+			return nil, nil
+		}
+		if diff, err = diffIPSnapshots(id, reportType, before, &snapshots[0]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	reasons := n.reasons(diff)
+	if len(reasons) == 0 {
+		return nil, nil
+	}
+
+	reasonsJSON, _ := json.Marshal(reasons)
+	diffJSON, _ := json.Marshal(diff)
+	alert := &models.Alert{
+		Indicator:      id,
+		Type:           reportType,
+		Reasons:        reasonsJSON,
+		Diff:           diffJSON,
+		FromSnapshotID: diff.From.ID,
+		ToSnapshotID:   diff.To.ID,
+	}
+	if err := repositories.SaveAlert(alert, n.db); err != nil {
+		log.Printf("Error saving alert for ID %s: %v", id, err)
+		return nil, err
+	}
+	log.Printf("Raised alert %d for ID: %s, Type: %s: %s", alert.ID, id, reportType, strings.Join(reasons, "; "))
+
+	n.deliver(ctx, alert)
+	return alert, nil
+}
+
+// reasons lists the thresholds the diff crosses
+func (n *AlertNotifier) reasons(diff *models.ReportDiff) []string {
+	var reasons []string
+	if change, ok := diff.Stats["malicious_count"]; ok && intValue(change.To)-intValue(change.From) >= n.thresholds.MaliciousIncrease {
+		reasons = append(reasons, fmt.Sprintf("malicious_count rose from %d to %d", intValue(change.From), intValue(change.To)))
+	}
+	if change, ok := diff.Stats["suspicious_count"]; ok && intValue(change.To)-intValue(change.From) >= n.thresholds.SuspiciousIncrease {
+		reasons = append(reasons, fmt.Sprintf("suspicious_count rose from %d to %d", intValue(change.From), intValue(change.To)))
+	}
+	if diff.Reputation != nil && intValue(diff.Reputation.From)-intValue(diff.Reputation.To) >= n.thresholds.ReputationDrop {
+		reasons = append(reasons, fmt.Sprintf("reputation fell from %d to %d", intValue(diff.Reputation.From), intValue(diff.Reputation.To)))
+	}
+
+	var flagged []string
+	for _, verdict := range diff.Verdicts {
+		if isDetection(verdict.To) && !isDetection(verdict.From) {
+			flagged = append(flagged, fmt.Sprintf("%s (%s)", verdict.Engine, verdict.To))
+		}
+	}
+	if len(flagged) > 0 && len(flagged) >= n.thresholds.EngineFlips {
+		reasons = append(reasons, fmt.Sprintf("%d engine(s) newly flagged it: %s", len(flagged), strings.Join(flagged, ", ")))
+	}
+	return reasons
+}
+
+// deliver posts the alert to every webhook and records the outcome on the alert
+func (n *AlertNotifier) deliver(ctx context.Context, alert *models.Alert) {
+	if len(n.webhookURLs) == 0 {
+		return
+	}
+	body, err := json.Marshal(models.AlertWebhookPayload{Event: "indicator.alert", Alert: alert})
+	if err != nil {
+		log.Printf("Error marshaling alert %d: %v", alert.ID, err)
+		return
+	}
+
+	var errs []error
+	for _, url := range n.webhookURLs {
+		if err := n.webhookClient.Post(ctx, url, body); err != nil {
+			log.Printf("Error delivering alert %d to %s: %v", alert.ID, url, err)
+			errs = append(errs, err)
+		}
+	}
+
+	var deliveredAt *time.Time
+	var deliveryError *string
+	if err := errors.Join(errs...); err != nil {
+		message := err.Error()
+		deliveryError = &message
+	} else {
+		now := time.Now()
+		deliveredAt = &now
+	}
+	alert.DeliveredAt, alert.DeliveryError = deliveredAt, deliveryError
+	if err := repositories.MarkAlertDelivery(alert.ID, deliveredAt, deliveryError, n.db); err != nil {
+		log.Printf("Error recording delivery of alert %d: %v", alert.ID, err)
+	}
+}
+
+// FetchAlerts lists alerts created after since, newest first
+func FetchAlerts(indicator, reportType string, since time.Time, limit, offset int, db *sqlx.DB) ([]models.Alert, error) {
+	return repositories.GetAlerts(indicator, reportType, since, limit, offset, db)
+}
+
+func isDetection(category string) bool {
+	return category == "malicious" || category == "suspicious"
+}
+
+func intValue(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
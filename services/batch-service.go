@@ -0,0 +1,360 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"vt-data-pipeline/indicator"
+	"vt-data-pipeline/jobs"
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/redis"
+	"vt-data-pipeline/repositories"
+	"vt-data-pipeline/vtclient"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MaxBatchItems is the largest batch accepted by FetchBatchReports
+const MaxBatchItems = 500
+
+// batchEntry is one distinct indicator of a batch, shared by all request items that name it
+type batchEntry struct {
+	reportType string
+	id         string // Value passed to the Fetch*Report function
+	lookupID   string // Primary key (or hash) in the DB
+	cacheKey   string
+	indexes    []int
+}
+
+// FetchBatchReports looks up a mixed list of indicators.
+// Cached items are read with one MGET, fresh stored items with one ANY($1) query per table,
+// and the remaining misses are queued as fetch jobs, so VirusTotal is never called while the request is open.
+// The same freshness options apply to every item; with ForceRefresh all of them are queued as refresh jobs.
+func FetchBatchReports(items []models.BatchItem, opts FetchOptions, db *sqlx.DB, redisClient *redis.Client, queue *jobs.Queue) ([]models.BatchResult, error) {
+	log.Printf("Starting FetchBatchReports for %d items", len(items))
+
+	results := make([]models.BatchResult, len(items))
+	var entries []*batchEntry
+	byCacheKey := map[string]*batchEntry{}
+
+	for i, item := range items {
+		// Items without a type get the one inferred from their id, echoed in the result
+		if item.Type == "" {
+			if reportType, err := indicator.Detect(item.ID); err == nil {
+				item.Type = reportType
+			}
+		}
+		results[i] = models.BatchResult{ID: item.ID, Type: item.Type}
+		entry, err := newBatchEntry(item)
+		if err != nil {
+			results[i].Status = models.BatchInvalid
+			results[i].Error = err.Error()
+			continue
+		}
+		if existing, ok := byCacheKey[entry.cacheKey]; ok {
+			existing.indexes = append(existing.indexes, i)
+			continue
+		}
+		entry.indexes = []int{i}
+		byCacheKey[entry.cacheKey] = entry
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return results, nil
+	}
+
+	entries = resolveBatchFileAliases(entries, redisClient)
+
+	misses := entries
+	if !opts.ForceRefresh {
+		var err error
+		if misses, err = batchFromCache(entries, results, opts, redisClient); err != nil {
+			return nil, err
+		}
+		log.Printf("Batch Redis lookup served %d of %d distinct items", len(entries)-len(misses), len(entries))
+
+		if len(misses) > 0 {
+			if misses, err = batchFromDB(misses, results, opts, db, redisClient); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(misses) > 0 {
+		log.Printf("Queueing %d batch items for a VirusTotal fetch", len(misses))
+		batchEnqueue(misses, results, opts, db, redisClient, queue)
+	}
+	return results, nil
+}
+
+// newBatchEntry validates and canonicalizes an item and derives its lookup and cache keys
+func newBatchEntry(item models.BatchItem) (*batchEntry, error) {
+	if item.ID == "" {
+		return nil, errors.New("id is required")
+	}
+	switch item.Type {
+	case "domains", "ip_addresses", "urls", "files":
+	default:
+		return nil, ErrUnsupportedType
+	}
+	id, err := indicator.Normalize(item.Type, item.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &batchEntry{reportType: item.Type, id: id, lookupID: id}
+	switch item.Type {
+	case "domains":
+		entry.cacheKey = fmt.Sprintf("domain:%s", id)
+	case "ip_addresses":
+		entry.cacheKey = fmt.Sprintf("ip:%s", id)
+	case "urls":
+		entry.lookupID = vtclient.URLIdentifier(id)
+		entry.cacheKey = fmt.Sprintf("url:%s", entry.lookupID)
+	case "files":
+		entry.cacheKey = fileCacheKey(id)
+	}
+	return entry, nil
+}
+
+// resolveBatchFileAliases moves files named by a known MD5 or SHA-1 to their SHA-256 with one MGET of the alias keys,
+// merging entries that turn out to name the same file
+func resolveBatchFileAliases(entries []*batchEntry, redisClient *redis.Client) []*batchEntry {
+	var aliased []*batchEntry
+	var keys []string
+	for _, entry := range entries {
+		if entry.reportType == "files" && len(entry.id) != 64 {
+			aliased = append(aliased, entry)
+			keys = append(keys, fileAliasPrefix+entry.id)
+		}
+	}
+	if len(keys) == 0 {
+		return entries
+	}
+	values, err := redisClient.MGet(context.Background(), keys...)
+	if err != nil {
+		log.Printf("Error reading batch file hash aliases from Redis: %v", err)
+		return entries
+	}
+	for i, entry := range aliased {
+		if sha256, ok := values[i].(string); ok && sha256 != "" {
+			entry.id, entry.lookupID, entry.cacheKey = sha256, sha256, fileCacheKey(sha256)
+		}
+	}
+
+	merged := make([]*batchEntry, 0, len(entries))
+	byCacheKey := map[string]*batchEntry{}
+	for _, entry := range entries {
+		if existing, ok := byCacheKey[entry.cacheKey]; ok {
+			existing.indexes = append(existing.indexes, entry.indexes...)
+			continue
+		}
+		byCacheKey[entry.cacheKey] = entry
+		merged = append(merged, entry)
+	}
+	return merged
+}
+
+// batchFromCache serves the entries found in Redis within the freshness options and returns the misses
+func batchFromCache(entries []*batchEntry, results []models.BatchResult, opts FetchOptions, redisClient *redis.Client) ([]*batchEntry, error) {
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.cacheKey
+	}
+	values, err := redisClient.MGet(context.Background(), keys...)
+	if err != nil {
+		log.Printf("Error reading batch from Redis: %v", err)
+		return nil, err
+	}
+
+	var misses []*batchEntry
+	for i, entry := range entries {
+		cachedData, ok := values[i].(string)
+		if !ok || cachedData == "" {
+			misses = append(misses, entry)
+			continue
+		}
+		report, err := decodeCachedReport(entry.reportType, cachedData)
+		if err != nil || report == nil || !batchReportFresh(opts, entry.reportType, report) {
+			misses = append(misses, entry)
+			continue
+		}
+		setBatchResult(results, entry, models.BatchCached, report)
+	}
+	return misses, nil
+}
+
+// decodeCachedReport decodes a cached report of the given type, returning nil for entries in an older format
+func decodeCachedReport(reportType, cachedData string) (any, error) {
+	switch reportType {
+	case "domains":
+		var report models.DomainReport
+		if err := json.Unmarshal([]byte(cachedData), &report); err != nil || report.Domain == nil {
+			return nil, err
+		}
+		return &report, nil
+	case "ip_addresses":
+		var report models.IPReport
+		if err := json.Unmarshal([]byte(cachedData), &report); err != nil || report.IP == nil {
+			return nil, err
+		}
+		return &report, nil
+	case "urls":
+		var report models.URLReport
+		if err := json.Unmarshal([]byte(cachedData), &report); err != nil || report.URL == nil {
+			return nil, err
+		}
+		return &report, nil
+	case "files":
+		var report models.FileReport
+		if err := json.Unmarshal([]byte(cachedData), &report); err != nil || report.File == nil {
+			return nil, err
+		}
+		return &report, nil
+	}
+	return nil, nil
+}
+
+// batchFromDB serves the entries with fresh DB data, caching them, and returns the misses.
+// Each query is bounded by the type's max age, risky rows are then checked against their tighter limit.
+func batchFromDB(entries []*batchEntry, results []models.BatchResult, opts FetchOptions, db *sqlx.DB, redisClient *redis.Client) ([]*batchEntry, error) {
+	ids := map[string][]string{}
+	for _, entry := range entries {
+		ids[entry.reportType] = append(ids[entry.reportType], entry.lookupID)
+	}
+	freshSince := func(reportType string) time.Time {
+		maxAge := opts.MaxAge
+		if maxAge <= 0 {
+			maxAge = opts.Freshness.MaxAgeFor(reportType, false)
+		}
+		return time.Now().Add(-maxAge)
+	}
+
+	var domains map[string]*models.DomainReport
+	var ips map[string]*models.IPReport
+	var urls map[string]*models.URLReport
+	var files map[string]*models.FileReport
+	var err error
+	if len(ids["domains"]) > 0 {
+		if domains, err = repositories.GetDomainReports(ids["domains"], freshSince("domains"), db); err != nil {
+			log.Printf("Error loading batch domain reports from DB: %v", err)
+			return nil, err
+		}
+	}
+	if len(ids["ip_addresses"]) > 0 {
+		if ips, err = repositories.GetIPReports(ids["ip_addresses"], freshSince("ip_addresses"), db); err != nil {
+			log.Printf("Error loading batch IP reports from DB: %v", err)
+			return nil, err
+		}
+	}
+	if len(ids["urls"]) > 0 {
+		if urls, err = repositories.GetURLReports(ids["urls"], freshSince("urls"), db); err != nil {
+			log.Printf("Error loading batch URL reports from DB: %v", err)
+			return nil, err
+		}
+	}
+	if len(ids["files"]) > 0 {
+		if files, err = repositories.GetFileReports(ids["files"], freshSince("files"), db); err != nil {
+			log.Printf("Error loading batch file reports from DB: %v", err)
+			return nil, err
+		}
+	}
+
+	var misses []*batchEntry
+	for _, entry := range entries {
+		var report any
+		switch entry.reportType {
+		case "domains":
+			if domainReport, ok := domains[entry.lookupID]; ok {
+				report = domainReport
+			}
+		case "ip_addresses":
+			if ipReport, ok := ips[entry.lookupID]; ok {
+				report = ipReport
+			}
+		case "urls":
+			if urlReport, ok := urls[entry.lookupID]; ok {
+				report = urlReport
+			}
+		case "files":
+			if fileReport, ok := files[entry.lookupID]; ok {
+				report = fileReport
+			}
+		}
+		if report == nil || !batchReportFresh(opts, entry.reportType, report) {
+			misses = append(misses, entry)
+			continue
+		}
+		cacheBatchReport(entry, report, opts, redisClient)
+		setBatchResult(results, entry, models.BatchStored, report)
+	}
+	return misses, nil
+}
+
+// batchReportFresh checks a cached or stored report against the freshness options
+func batchReportFresh(opts FetchOptions, reportType string, report any) bool {
+	updatedAt, malicious, suspicious, ok := reportState(report)
+	return ok && opts.isFresh(reportType, updatedAt, malicious, suspicious)
+}
+
+// cacheBatchReport caches a report served from the DB with the TTL of the freshness policy
+func cacheBatchReport(entry *batchEntry, report any, opts FetchOptions, redisClient *redis.Client) {
+	switch r := report.(type) {
+	case *models.DomainReport:
+		cacheDomainReport(entry.cacheKey, r, opts.cacheTTL(entry.reportType, r.Domain.MaliciousCount, r.Domain.SuspiciousCount), redisClient)
+	case *models.IPReport:
+		cacheIPReport(entry.cacheKey, r, opts.cacheTTL(entry.reportType, r.IP.MaliciousCount, r.IP.SuspiciousCount), redisClient)
+	case *models.URLReport:
+		cacheURLReport(entry.cacheKey, r, opts.cacheTTL(entry.reportType, r.URL.MaliciousCount, r.URL.SuspiciousCount), redisClient)
+	case *models.FileReport:
+		cacheFileReport(r, opts.cacheTTL(entry.reportType, r.File.MaliciousCount, r.File.SuspiciousCount), redisClient)
+	}
+}
+
+// batchEnqueue queues a fetch job for every miss and records its job id. A miss that already has an unfinished job
+// gets that job's id, so polling the same batch does not queue another fetch per poll.
+// Misses VirusTotal recently reported as unknown are answered from the negative cache instead.
+// A miss under a tighter max_age means the stored report is too old, so like ForceRefresh it queues a refresh job.
+func batchEnqueue(entries []*batchEntry, results []models.BatchResult, opts FetchOptions, db *sqlx.DB, redisClient *redis.Client, queue *jobs.Queue) {
+	refresh := opts.ForceRefresh || opts.MaxAge > 0
+	for _, entry := range entries {
+		if err := checkNotFound(entry.cacheKey, entry.reportType, entry.lookupID, opts, db, redisClient); err != nil {
+			setBatchError(results, entry, err)
+			continue
+		}
+		job, err := queue.EnqueueOnce(context.Background(), entry.reportType, entry.id, refresh)
+		if err != nil {
+			log.Printf("Error queueing batch item %s (%s): %v", entry.id, entry.reportType, err)
+			setBatchError(results, entry, err)
+			continue
+		}
+		for _, i := range entry.indexes {
+			results[i].Status = models.BatchQueued
+			results[i].JobID = job.ID
+		}
+	}
+}
+
+// setBatchResult records a report for every request item of the entry
+func setBatchResult(results []models.BatchResult, entry *batchEntry, status string, report any) {
+	for _, i := range entry.indexes {
+		results[i].Status = status
+		results[i].Report = report
+	}
+}
+
+// setBatchError records a failure for every request item of the entry
+func setBatchError(results []models.BatchResult, entry *batchEntry, err error) {
+	status := models.BatchError
+	if errors.Is(err, vtclient.ErrNotFound) {
+		status = models.BatchNotFound
+	}
+	for _, i := range entry.indexes {
+		results[i].Status = status
+		results[i].Error = err.Error()
+	}
+}
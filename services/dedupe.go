@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"vt-data-pipeline/redis"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// fetchLockTTL is how long the fetch lock of an indicator outlives a crashed holder.
+	// A running fetch renews it every fetchLockRenewInterval, so limiter waits and key retries cannot outlast it.
+	fetchLockTTL = 30 * time.Second
+	// fetchLockRenewInterval is how often the holder extends the lock
+	fetchLockRenewInterval = fetchLockTTL / 3
+	// fetchLockMaxWait bounds how long a replica waits for another replica's fetch
+	fetchLockMaxWait = 10 * time.Minute
+	// fetchLockPollInterval is how often a waiting replica checks the cache and the lock
+	fetchLockPollInterval = 250 * time.Millisecond
+)
+
+// releaseLockScript deletes the lock only if it is still held by our token
+const releaseLockScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+// extendLockScript resets the TTL of the lock only if it is still held by our token
+const extendLockScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`
+
+// fetchGroup collapses concurrent fetches of the same cache key within this process
+var fetchGroup singleflight.Group
+
+// fetchOnce makes sure one fetch/persist runs per key at a time across all replicas. The key is the cache key
+// plus the fetch options (see FetchOptions.fetchKey). Concurrent callers in this process share one call through singleflight.
+// That call takes a Redis lock on the key; callers on other replicas wait for the lock holder to fill the cache and read it back.
+func fetchOnce[T any](cacheKey string, redisClient *redis.Client, readCache func() (*T, error), fetch func() (*T, error)) (*T, error) {
+	v, err, shared := fetchGroup.Do(cacheKey, func() (any, error) {
+		return fetchLocked(cacheKey, redisClient, readCache, fetch)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if shared {
+		log.Printf("Shared in-flight fetch result for key: %s", cacheKey)
+	}
+	return v.(*T), nil
+}
+
+// fetchLocked runs fetch while holding the distributed lock of the cache key
+func fetchLocked[T any](cacheKey string, redisClient *redis.Client, readCache func() (*T, error), fetch func() (*T, error)) (*T, error) {
+	ctx := context.Background()
+	lockKey := "lock:" + cacheKey
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(fetchLockMaxWait)
+	for {
+		acquired, err := redisClient.SetNX(ctx, lockKey, token, fetchLockTTL)
+		if err != nil {
+			log.Printf("Error acquiring fetch lock %s: %v", lockKey, err)
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for fetch lock %s", lockKey)
+		}
+
+		time.Sleep(fetchLockPollInterval)
+		if report, err := readCache(); err == nil && report != nil {
+			log.Printf("Fetch by another replica filled cache for key: %s", cacheKey)
+			return report, nil
+		}
+	}
+	stopRenewing := renewLock(lockKey, token, redisClient)
+	defer func() {
+		stopRenewing()
+		if _, err := redisClient.Eval(ctx, releaseLockScript, []string{lockKey}, token); err != nil {
+			log.Printf("Error releasing fetch lock %s: %v", lockKey, err)
+		}
+	}()
+
+	// Another replica may have filled the cache between our miss and taking the lock
+	if report, err := readCache(); err == nil && report != nil {
+		log.Printf("Redis cache filled while waiting for lock, key: %s", cacheKey)
+		return report, nil
+	}
+	return fetch()
+}
+
+// renewLock extends the lock every fetchLockRenewInterval until the returned function is called
+func renewLock(lockKey, token string, redisClient *redis.Client) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(fetchLockRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				extended, err := redisClient.Eval(context.Background(), extendLockScript, []string{lockKey}, token, fetchLockTTL.Milliseconds())
+				if err != nil {
+					log.Printf("Error extending fetch lock %s: %v", lockKey, err)
+					continue
+				}
+				if n, ok := extended.(int64); ok && n == 0 {
+					log.Printf("Fetch lock %s was lost, another replica may fetch the same indicator", lockKey)
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// lockToken returns a random value identifying the lock owner
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/repositories"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// FetchDiff compares the snapshots of a domain or IP in effect at from and at to
+func FetchDiff(id, reportType string, from, to time.Time, db *sqlx.DB) (*models.ReportDiff, error) {
+	log.Printf("Starting FetchDiff for ID: %s, Type: %s, From: %v, To: %v", id, reportType, from, to)
+
+	switch reportType {
+	case "domains":
+		return diffDomain(id, reportType, from, to, db)
+	case "ip_addresses":
+		return diffIP(id, reportType, from, to, db)
+	}
+	return nil, fmt.Errorf("diff is not supported for %s", reportType)
+}
+
+// diffDomain compares two domain snapshots, including DNS records and the HTTPS certificate
+func diffDomain(id, reportType string, from, to time.Time, db *sqlx.DB) (*models.ReportDiff, error) {
+	before, err := repositories.GetDomainSnapshotAt(id, from, db)
+	if err != nil {
+		return nil, snapshotError(err)
+	}
+	after, err := repositories.GetDomainSnapshotAt(id, to, db)
+	if err != nil {
+		return nil, snapshotError(err)
+	}
+	return diffDomainSnapshots(id, reportType, before, after)
+}
+
+// diffDomainSnapshots compares two snapshots of the same domain, failing on snapshot JSON that does not decode
+func diffDomainSnapshots(id, reportType string, before, after *models.DomainSnapshot) (*models.ReportDiff, error) {
+	diff := &models.ReportDiff{
+		ID:      id,
+		Type:    reportType,
+		From:    models.SnapshotRef{ID: before.ID, FetchedAt: before.FetchedAt, ResponseHash: before.ResponseHash},
+		To:      models.SnapshotRef{ID: after.ID, FetchedAt: after.FetchedAt, ResponseHash: after.ResponseHash},
+		Changed: before.ResponseHash != after.ResponseHash,
+	}
+	if !equalInt(before.Reputation, after.Reputation) {
+		diff.Reputation = &models.IntChange{From: before.Reputation, To: after.Reputation}
+	}
+	diff.Stats = diffStats(
+		[]*int{before.HarmlessCount, before.MaliciousCount, before.SuspiciousCount, before.UndetectedCount, before.TimeoutCount},
+		[]*int{after.HarmlessCount, after.MaliciousCount, after.SuspiciousCount, after.UndetectedCount, after.TimeoutCount},
+	)
+	var err error
+	if diff.Verdicts, err = diffVerdicts(before.Verdicts, after.Verdicts); err != nil {
+		return nil, snapshotDecodeError("verdicts", before.ID, after.ID, err)
+	}
+	if diff.DNSRecordsAdded, diff.DNSRecordsRemoved, err = diffDNSRecords(before.DNSRecords, after.DNSRecords); err != nil {
+		return nil, snapshotDecodeError("dns_records", before.ID, after.ID, err)
+	}
+	if !equalString(before.CertificateThumbprint, after.CertificateThumbprint) {
+		diff.Certificate = &models.StringChange{From: before.CertificateThumbprint, To: after.CertificateThumbprint}
+	}
+	return diff, nil
+}
+
+// diffIP compares two IP snapshots, including tags
+func diffIP(id, reportType string, from, to time.Time, db *sqlx.DB) (*models.ReportDiff, error) {
+	before, err := repositories.GetIPSnapshotAt(id, from, db)
+	if err != nil {
+		return nil, snapshotError(err)
+	}
+	after, err := repositories.GetIPSnapshotAt(id, to, db)
+	if err != nil {
+		return nil, snapshotError(err)
+	}
+	return diffIPSnapshots(id, reportType, before, after)
+}
+
+// diffIPSnapshots compares two snapshots of the same IP, failing on snapshot JSON that does not decode
+func diffIPSnapshots(id, reportType string, before, after *models.IPSnapshot) (*models.ReportDiff, error) {
+	diff := &models.ReportDiff{
+		ID:      id,
+		Type:    reportType,
+		From:    models.SnapshotRef{ID: before.ID, FetchedAt: before.FetchedAt, ResponseHash: before.ResponseHash},
+		To:      models.SnapshotRef{ID: after.ID, FetchedAt: after.FetchedAt, ResponseHash: after.ResponseHash},
+		Changed: before.ResponseHash != after.ResponseHash,
+	}
+	if !equalInt(before.Reputation, after.Reputation) {
+		diff.Reputation = &models.IntChange{From: before.Reputation, To: after.Reputation}
+	}
+	diff.Stats = diffStats(
+		[]*int{before.HarmlessCount, before.MaliciousCount, before.SuspiciousCount, before.UndetectedCount, before.TimeoutCount},
+		[]*int{after.HarmlessCount, after.MaliciousCount, after.SuspiciousCount, after.UndetectedCount, after.TimeoutCount},
+	)
+	var err error
+	if diff.Verdicts, err = diffVerdicts(before.Verdicts, after.Verdicts); err != nil {
+		return nil, snapshotDecodeError("verdicts", before.ID, after.ID, err)
+	}
+	if diff.TagsAdded, diff.TagsRemoved, err = diffTags(before.Tags, after.Tags); err != nil {
+		return nil, snapshotDecodeError("tags", before.ID, after.ID, err)
+	}
+	return diff, nil
+}
+
+// snapshotError maps a missing snapshot onto ErrNotStored
+func snapshotError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotStored
+	}
+	return err
+}
+
+// snapshotDecodeError reports a snapshot column that does not decode, so a corrupt row is never diffed as empty
+func snapshotDecodeError(column string, beforeID, afterID int64, err error) error {
+	return fmt.Errorf("decoding %s of snapshots %d/%d: %w", column, beforeID, afterID, err)
+}
+
+// decodeSnapshotJSON decodes a JSONB snapshot column into v, leaving v empty for NULL
+func decodeSnapshotJSON(data []byte, v any) error {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// statNames are the last_analysis_stats counters in the order diffStats receives them
+var statNames = []string{"harmless_count", "malicious_count", "suspicious_count", "undetected_count", "timeout_count"}
+
+// diffStats returns the analysis stats counters that differ
+func diffStats(before, after []*int) map[string]models.IntChange {
+	changes := map[string]models.IntChange{}
+	for i, name := range statNames {
+		if !equalInt(before[i], after[i]) {
+			changes[name] = models.IntChange{From: before[i], To: after[i]}
+		}
+	}
+	return changes
+}
+
+// diffVerdicts returns the engines whose category changed, sorted by engine name
+func diffVerdicts(beforeJSON, afterJSON []byte) ([]models.VerdictChange, error) {
+	before := map[string]string{}
+	after := map[string]string{}
+	if err := decodeSnapshotJSON(beforeJSON, &before); err != nil {
+		return nil, err
+	}
+	if err := decodeSnapshotJSON(afterJSON, &after); err != nil {
+		return nil, err
+	}
+
+	engines := make(map[string]bool, len(after))
+	for engine := range before {
+		engines[engine] = true
+	}
+	for engine := range after {
+		engines[engine] = true
+	}
+
+	var changes []models.VerdictChange
+	for engine := range engines {
+		if before[engine] != after[engine] {
+			changes = append(changes, models.VerdictChange{Engine: engine, From: before[engine], To: after[engine]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Engine < changes[j].Engine })
+	return changes, nil
+}
+
+// diffTags returns the tags added and removed between two tag lists
+func diffTags(beforeJSON, afterJSON []byte) (added, removed []string, err error) {
+	var before, after []string
+	if err := decodeSnapshotJSON(beforeJSON, &before); err != nil {
+		return nil, nil, err
+	}
+	if err := decodeSnapshotJSON(afterJSON, &after); err != nil {
+		return nil, nil, err
+	}
+
+	added = missingFrom(after, before, func(tag string) string { return tag })
+	removed = missingFrom(before, after, func(tag string) string { return tag })
+	return added, removed, nil
+}
+
+// diffDNSRecords returns the DNS records added and removed, ignoring TTL changes
+func diffDNSRecords(beforeJSON, afterJSON []byte) (added, removed []models.DNSRecord, err error) {
+	var before, after []models.DNSRecord
+	if err := decodeSnapshotJSON(beforeJSON, &before); err != nil {
+		return nil, nil, err
+	}
+	if err := decodeSnapshotJSON(afterJSON, &after); err != nil {
+		return nil, nil, err
+	}
+
+	recordKey := func(record models.DNSRecord) string { return record.Type + " " + record.Value }
+	added = missingFrom(after, before, recordKey)
+	removed = missingFrom(before, after, recordKey)
+	return added, removed, nil
+}
+
+// missingFrom returns the items of list whose key does not occur in other, keeping their order
+func missingFrom[T any](list, other []T, key func(T) string) []T {
+	present := make(map[string]bool, len(other))
+	for _, item := range other {
+		present[key(item)] = true
+	}
+	var missing []T
+	for _, item := range list {
+		if !present[key(item)] {
+			missing = append(missing, item)
+			present[key(item)] = true
+		}
+	}
+	return missing
+}
+
+func equalInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func equalString(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"vt-data-pipeline/models"
+)
+
+func TestDiffVerdicts(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		want          []models.VerdictChange
+		wantErr       bool
+	}{
+		{
+			name:   "unchanged",
+			before: `{"Kaspersky": "harmless"}`,
+			after:  `{"Kaspersky": "harmless"}`,
+		},
+		{
+			name:   "flipped, added and dropped engines sorted by name",
+			before: `{"Kaspersky": "harmless", "Sophos": "undetected"}`,
+			after:  `{"Kaspersky": "malicious", "BitDefender": "suspicious"}`,
+			want: []models.VerdictChange{
+				{Engine: "BitDefender", To: "suspicious"},
+				{Engine: "Kaspersky", From: "harmless", To: "malicious"},
+				{Engine: "Sophos", From: "undetected"},
+			},
+		},
+		{
+			name:  "NULL before",
+			after: `{"Kaspersky": "malicious"}`,
+			want:  []models.VerdictChange{{Engine: "Kaspersky", To: "malicious"}},
+		},
+		{
+			name:   "null literal after",
+			before: `{"Kaspersky": "malicious"}`,
+			after:  `null`,
+			want:   []models.VerdictChange{{Engine: "Kaspersky", From: "malicious"}},
+		},
+		{
+			name:    "corrupt before",
+			before:  `{"Kaspersky":`,
+			after:   `{}`,
+			wantErr: true,
+		},
+		{
+			name:    "wrong shape after",
+			before:  `{}`,
+			after:   `["Kaspersky"]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := diffVerdicts([]byte(tt.before), []byte(tt.after))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: diffVerdicts error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: diffVerdicts = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiffTags(t *testing.T) {
+	tests := []struct {
+		name                string
+		before, after       string
+		wantAdded, wantGone []string
+		wantErr             bool
+	}{
+		{
+			name:   "unchanged in another order",
+			before: `["phishing", "malware"]`,
+			after:  `["malware", "phishing"]`,
+		},
+		{
+			name:      "added and removed keep their order",
+			before:    `["phishing", "malware", "spam"]`,
+			after:     `["malware", "c2", "botnet"]`,
+			wantAdded: []string{"c2", "botnet"},
+			wantGone:  []string{"phishing", "spam"},
+		},
+		{
+			name:      "duplicates are reported once",
+			before:    `[]`,
+			after:     `["c2", "c2"]`,
+			wantAdded: []string{"c2"},
+		},
+		{
+			name:     "NULL after",
+			before:   `["c2"]`,
+			wantGone: []string{"c2"},
+		},
+		{
+			name:    "corrupt after",
+			before:  `[]`,
+			after:   `["c2"`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		added, removed, err := diffTags([]byte(tt.before), []byte(tt.after))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: diffTags error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(added, tt.wantAdded) || !reflect.DeepEqual(removed, tt.wantGone) {
+			t.Errorf("%s: diffTags = %v, %v, want %v, %v", tt.name, added, removed, tt.wantAdded, tt.wantGone)
+		}
+	}
+}
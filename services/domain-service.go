@@ -5,89 +5,104 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
-	"sync"
 	"time"
 
-	"vt-data-pipeline/config"
 	"vt-data-pipeline/models"
 	"vt-data-pipeline/redis"
 	"vt-data-pipeline/repositories"
+	"vt-data-pipeline/vtclient"
 
 	"github.com/jmoiron/sqlx"
 )
 
-func FetchDomainVTReport(id, reportType string, db *sqlx.DB, redisClient *redis.Client, cfg *config.Config) (*models.Domain, error) {
+func FetchDomainVTReport(id, reportType string, db *sqlx.DB, redisClient *redis.Client, vtClient vtclient.Client, opts FetchOptions) (*models.DomainReport, error) {
 	log.Printf("Starting FetchVTReport for ID: %s, Type: %s", id, reportType)
 
-	// Check Redis cache first
+	// Check Redis cache first, unless the caller asked for a refresh or a tighter max age
 	cacheKey := fmt.Sprintf("domain:%s", id)
-	cachedData, err := redisClient.Get(context.Background(), cacheKey)
-	if err == nil && cachedData != "" {
-		log.Printf("Redis cache hit for ID: %s", id)
-		var domain models.Domain
-		if err := json.Unmarshal([]byte(cachedData), &domain); err != nil {
-			log.Printf("Error unmarshaling cached data for ID %s: %v", id, err)
+	readCache := func() (*models.DomainReport, error) {
+		if opts.ForceRefresh {
+			return nil, nil
+		}
+		report, err := getCachedDomainReport(cacheKey, redisClient)
+		if err != nil || report == nil || !opts.isFresh(reportType, report.Domain.UpdatedAt, report.Domain.MaliciousCount, report.Domain.SuspiciousCount) {
 			return nil, err
 		}
-		return &domain, nil
+		return report, nil
+	}
+	report, err := readCache()
+	if err != nil {
+		log.Printf("Error unmarshaling cached data for ID %s: %v", id, err)
+		return nil, err
+	}
+	if report != nil {
+		log.Printf("Redis cache hit for ID: %s", id)
+		return report, nil
 	}
 	log.Printf("Redis cache miss for ID: %s, proceeding with API call", id)
 
-	// Check database for recent data (updated within last 24 hours)
-	domainFromDB, err := repositories.GetDomain(id, db)
-	if err == nil && domainFromDB != nil {
-		if time.Since(domainFromDB.UpdatedAt) < 24*time.Hour {
-			log.Printf("Found recent domain data in DB for ID: %s, updated at: %v", id, domainFromDB.UpdatedAt)
-			domainJSON, err := json.Marshal(domainFromDB)
-			if err != nil {
-				log.Printf("Error marshaling domain for cache: %v", err)
-			} else {
-				if err := redisClient.Set(context.Background(), cacheKey, domainJSON, time.Hour); err != nil {
-					log.Printf("Error saving to Redis cache: %v", err)
-				} else {
-					log.Printf("Successfully saved to Redis cache for ID: %s", id)
+	// Only one DB/VT fetch per indicator runs at a time, in this process and across replicas
+	return fetchOnce(opts.fetchKey(cacheKey), redisClient,
+		readCache,
+		func() (*models.DomainReport, error) {
+			return loadDomainReport(id, reportType, cacheKey, db, redisClient, vtClient, opts)
+		})
+}
+
+// loadDomainReport loads a fresh report from the DB, or fetches it from VirusTotal and persists it
+func loadDomainReport(id, reportType, cacheKey string, db *sqlx.DB, redisClient *redis.Client, vtClient vtclient.Client, opts FetchOptions) (*models.DomainReport, error) {
+	// Check database for data within the freshness policy, unless the caller asked for a refresh
+	if !opts.ForceRefresh {
+		domainFromDB, err := repositories.GetDomain(id, db)
+		if err == nil && domainFromDB != nil {
+			if opts.isFresh(reportType, domainFromDB.UpdatedAt, domainFromDB.MaliciousCount, domainFromDB.SuspiciousCount) {
+				log.Printf("Found recent domain data in DB for ID: %s, updated at: %v", id, domainFromDB.UpdatedAt)
+				report, err := repositories.GetDomainReport(id, nil, db)
+				if err != nil {
+					log.Printf("Error loading domain report from DB for ID %s: %v", id, err)
+					return nil, err
+				}
+				cacheDomainReport(cacheKey, report, opts.cacheTTL(reportType, report.Domain.MaliciousCount, report.Domain.SuspiciousCount), redisClient)
+				return report, nil
+			}
+			if opts.serveStale(domainFromDB.UpdatedAt) {
+				log.Printf("Serving stale domain data for ID: %s, updated at: %v, refreshing in the background", id, domainFromDB.UpdatedAt)
+				report, err := repositories.GetDomainReport(id, nil, db)
+				if err != nil {
+					log.Printf("Error loading domain report from DB for ID %s: %v", id, err)
+					return nil, err
 				}
+				opts.revalidate(cacheKey, reportType, id, redisClient)
+				return report, nil
 			}
-			return domainFromDB, nil
+			log.Printf("DB data for ID %s is stale (updated at: %v), proceeding with API call", id, domainFromDB.UpdatedAt)
+		} else if err != nil {
+			log.Printf("No domain data found in DB for ID %s or error: %v", id, err)
 		}
-		log.Printf("DB data for ID %s is stale (updated at: %v), proceeding with API call", id, domainFromDB.UpdatedAt)
-	} else if err != nil {
-		log.Printf("No domain data found in DB for ID %s or error: %v", id, err)
 	}
-	log.Printf("Proceeding with VirusTotal API call for ID: %s", id)
-
-	// Fetch from VirusTotal API
-	url := fmt.Sprintf("https://www.virustotal.com/api/v3/%s/%s", reportType, id)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("x-apikey", cfg.VirusTotal.APIKey)
 
-	client := &http.Client{}
-	log.Printf("Making API request to VirusTotal for ID: %s", id)
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Error making API request for ID %s: %v", id, err)
+	// Skip indicators VirusTotal recently reported as unknown
+	if err := checkNotFound(cacheKey, reportType, id, opts, db, redisClient); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	log.Printf("Proceeding with VirusTotal API call for ID: %s", id)
 
-	// Parse API response
-	var vtResponse models.VirusTotalDomainResponse
-	err = json.NewDecoder(resp.Body).Decode(&vtResponse)
+	// Fetch from VirusTotal API
+	log.Printf("Making API request to VirusTotal for ID: %s", id)
+	vtResponse, err := vtClient.GetDomain(context.Background(), id)
 	if err != nil {
-		log.Printf("Error decoding API response for ID %s: %v", id, err)
+		log.Printf("Error fetching VirusTotal report for ID %s: %v", id, err)
+		recordNotFound(err, cacheKey, reportType, id, opts, db, redisClient)
 		return nil, err
 	}
 	log.Printf("Successfully decoded API response for ID: %s", id)
 
-	// Begin transaction
-	tx, err := db.Beginx()
-	if err != nil {
-		log.Printf("Error beginning transaction for ID %s: %v", id, err)
-		return nil, err
-	}
-	defer tx.Rollback()
+	// Persist in one transaction, the writer caches the report after commit
+	return NewReportWriter(db, redisClient, opts).WriteDomain(id, reportType, cacheKey, vtResponse)
+}
 
+// domainFromVT converts a VirusTotal domain response into the domains and domain_details rows
+func domainFromVT(id, reportType string, vtResponse *models.VirusTotalDomainResponse) (*models.Domain, *models.DomainDetails) {
 	// Convert timestamps
 	var creationDate, expirationDate, lastAnalysisDate, whoisDate *time.Time
 	if vtResponse.Data.Attributes.CreationDate != 0 {
@@ -134,14 +149,7 @@ func FetchDomainVTReport(id, reportType string, db *sqlx.DB, redisClient *redis.
 		UpdatedAt:        time.Now(),
 	}
 
-	// Save domain data
-	if err := repositories.SaveDomain(tx, domain); err != nil {
-		log.Printf("Error saving domain data for ID %s: %v", id, err)
-		return nil, err
-	}
-	log.Printf("Successfully saved domain data for ID: %s", id)
-
-	// Save domain details
+	// Collect domain details
 	dnsRecordsJSON, _ := json.Marshal(vtResponse.Data.Attributes.LastDNSRecords)
 	certificateJSON, _ := json.Marshal(vtResponse.Data.Attributes.LastHTTPSCertificate)
 	rdapJSON, _ := json.Marshal(vtResponse.Data.Attributes.RDAP)
@@ -158,68 +166,36 @@ func FetchDomainVTReport(id, reportType string, db *sqlx.DB, redisClient *redis.
 		TotalVotes:           votesJSON,
 	}
 
-	if err := repositories.SaveDomainDetails(tx, details); err != nil {
-		log.Printf("Error saving domain details for ID %s: %v", id, err)
-		return nil, err
-	}
-	log.Printf("Successfully saved domain details for ID: %s", id)
-
-	// go routine for insert categories and analysis
-	errChan := make(chan error, 2)
-	var wg sync.WaitGroup
-
-	// Save categories
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := repositories.SaveDomainCategories(tx, id, vtResponse.Data.Attributes.Categories); err != nil {
-			log.Printf("Error saving categories for ID %s: %v", id, err)
-			errChan <- err
-			return
-		}
-		log.Printf("Successfully saved categories for ID: %s", id)
-	}()
-
-	// Save analysis results
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := repositories.SaveDomainAnalysisResults(tx, id, vtResponse.Data.Attributes.LastAnalysisResults); err != nil {
-			log.Printf("Error saving analysis results for ID %s: %v", id, err)
-			errChan <- err
-			return
-		}
-		log.Printf("Successfully saved analysis results for ID: %s", id)
-	}()
-
-	wg.Wait()
-	close(errChan)
-
-	// Check for any errors
-	for err := range errChan {
-		if err != nil {
-			return nil, err
-		}
-	}
+	return domain, details
+}
 
-	// Save to Redis cache
-	domainJSON, err := json.Marshal(domain)
+// cacheDomainReport stores the full domain report in Redis
+func cacheDomainReport(cacheKey string, report *models.DomainReport, ttl time.Duration, redisClient *redis.Client) {
+	reportJSON, err := json.Marshal(report)
 	if err != nil {
-		log.Printf("Error marshaling domain for cache: %v", err)
-	} else {
-		if err := redisClient.Set(context.Background(), cacheKey, domainJSON, time.Hour); err != nil {
-			log.Printf("Error saving to Redis cache: %v", err)
-		} else {
-			log.Printf("Successfully saved to Redis cache for ID: %s", id)
-		}
+		log.Printf("Error marshaling domain report for cache: %v", err)
+		return
+	}
+	if err := redisClient.Set(context.Background(), cacheKey, reportJSON, ttl); err != nil {
+		log.Printf("Error saving to Redis cache: %v", err)
+		return
 	}
+	log.Printf("Successfully saved to Redis cache for key: %s", cacheKey)
+}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction for ID %s: %v", id, err)
+// getCachedDomainReport returns the cached report, or nil on a cache miss
+func getCachedDomainReport(cacheKey string, redisClient *redis.Client) (*models.DomainReport, error) {
+	cachedData, err := redisClient.Get(context.Background(), cacheKey)
+	if err != nil || cachedData == "" {
+		return nil, nil
+	}
+	var report models.DomainReport
+	if err := json.Unmarshal([]byte(cachedData), &report); err != nil {
 		return nil, err
 	}
-	log.Printf("Successfully committed transaction for ID: %s", id)
-
-	return domain, nil
+	if report.Domain == nil {
+		log.Printf("Cached data for key %s predates the full report format, ignoring it", cacheKey)
+		return nil, nil
+	}
+	return &report, nil
 }
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"vt-data-pipeline/config"
+	"vt-data-pipeline/jobs"
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/redis"
+)
+
+// revalidateLockTTL keeps a burst of stale reads from queueing more than one refresh per indicator
+const revalidateLockTTL = 10 * time.Minute
+
+// FetchOptions tune a single report fetch
+type FetchOptions struct {
+	Freshness config.FreshnessPolicy
+	// MaxAge overrides the policy's maximum age of stored and cached data when set
+	MaxAge time.Duration
+	// ForceRefresh skips Redis and the DB and always asks VirusTotal
+	ForceRefresh bool
+	// Revalidate enables stale-while-revalidate: stale DB data is returned at once
+	// and a refresh job is queued here instead of blocking on VirusTotal
+	Revalidate *jobs.Queue
+}
+
+// fetchKey keys the in-flight fetch and the fetch lock of a cache key. Only callers that accept the same data
+// share a fetch, so a refresh or a tighter max age never gets the result of a plain lookup back.
+func (o FetchOptions) fetchKey(cacheKey string) string {
+	if o.ForceRefresh {
+		return cacheKey + ":refresh"
+	}
+	if o.MaxAge > 0 {
+		return cacheKey + ":max_age=" + o.MaxAge.String()
+	}
+	return cacheKey
+}
+
+// isFresh reports whether data updated at updatedAt may still be served
+func (o FetchOptions) isFresh(reportType string, updatedAt time.Time, malicious, suspicious *int) bool {
+	maxAge := o.MaxAge
+	if maxAge <= 0 {
+		maxAge = o.Freshness.MaxAgeFor(reportType, isRisky(malicious, suspicious))
+	}
+	return time.Since(updatedAt) < maxAge
+}
+
+// cacheTTL returns how long a report is kept in Redis
+func (o FetchOptions) cacheTTL(reportType string, malicious, suspicious *int) time.Duration {
+	return o.Freshness.CacheTTLFor(reportType, isRisky(malicious, suspicious))
+}
+
+// serveStale reports whether stale data updated at updatedAt is returned while a refresh is queued
+func (o FetchOptions) serveStale(updatedAt time.Time) bool {
+	if o.Revalidate == nil {
+		return false
+	}
+	return o.Freshness.MaxStale <= 0 || time.Since(updatedAt) < o.Freshness.MaxStale
+}
+
+// revalidate queues a refresh of a stale indicator unless one was queued recently
+func (o FetchOptions) revalidate(cacheKey, reportType, id string, redisClient *redis.Client) {
+	ctx := context.Background()
+	queued, err := redisClient.SetNX(ctx, "revalidate:"+cacheKey, "1", revalidateLockTTL)
+	if err != nil {
+		log.Printf("Error taking revalidate lock for ID %s: %v", id, err)
+		return
+	}
+	if !queued {
+		log.Printf("Refresh of ID %s is already queued", id)
+		return
+	}
+	job, err := o.Revalidate.Enqueue(ctx, reportType, id, true)
+	if err != nil {
+		log.Printf("Error queueing refresh for ID %s: %v", id, err)
+		redisClient.Delete(ctx, "revalidate:"+cacheKey)
+		return
+	}
+	log.Printf("Queued background refresh job %s for ID: %s", job.ID, id)
+}
+
+// Staleness returns how old a report is and whether it is past the freshness options
+func (o FetchOptions) Staleness(reportType string, report any) (time.Duration, bool) {
+	updatedAt, malicious, suspicious, ok := reportState(report)
+	if !ok {
+		return 0, false
+	}
+	return time.Since(updatedAt), !o.isFresh(reportType, updatedAt, malicious, suspicious)
+}
+
+// reportState returns when a report was last updated and its detection counts
+func reportState(report any) (time.Time, *int, *int, bool) {
+	switch r := report.(type) {
+	case *models.DomainReport:
+		return r.Domain.UpdatedAt, r.Domain.MaliciousCount, r.Domain.SuspiciousCount, true
+	case *models.IPReport:
+		return r.IP.UpdatedAt, r.IP.MaliciousCount, r.IP.SuspiciousCount, true
+	case *models.URLReport:
+		return r.URL.UpdatedAt, r.URL.MaliciousCount, r.URL.SuspiciousCount, true
+	case *models.FileReport:
+		return r.File.UpdatedAt, r.File.MaliciousCount, r.File.SuspiciousCount, true
+	}
+	return time.Time{}, nil, nil, false
+}
+
+// isRisky reports whether any engine flagged the indicator
+func isRisky(malicious, suspicious *int) bool {
+	return intValue(malicious) > 0 || intValue(suspicious) > 0
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"vt-data-pipeline/indicator"
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/redis"
+	"vt-data-pipeline/repositories"
+	"vt-data-pipeline/vtclient"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// fileAliasPrefix prefixes the keys mapping an MD5 or SHA-1 to the SHA-256 a file is stored and cached under
+	fileAliasPrefix = "filehash:"
+	// fileAliasTTL is long because the hashes of a file never change
+	fileAliasTTL = 30 * 24 * time.Hour
+)
+
+// FetchFileReport returns the report of a file looked up by its MD5, SHA-1 or SHA-256.
+// The file is stored and cached under its SHA-256. MD5 and SHA-1 are resolved through alias keys or the files table;
+// a hash that resolves to nothing yet is only used for the fetch lock and the negative cache.
+func FetchFileReport(hash, reportType string, db *sqlx.DB, redisClient *redis.Client, vtClient vtclient.Client, opts FetchOptions) (*models.FileReport, error) {
+	log.Printf("Starting FetchFileReport for ID: %s, Type: %s", hash, reportType)
+
+	hash, err := indicator.Hash(hash)
+	if err != nil {
+		return nil, err
+	}
+	if sha256, ok := resolveFileHash(hash, db, redisClient); ok {
+		hash = sha256
+	}
+
+	// Check Redis cache first, unless the caller asked for a refresh or a tighter max age.
+	// An unresolved MD5 or SHA-1 is resolved again on every read, so waiters find the report
+	// another replica fetched and cached under the SHA-256.
+	cacheKey := fileCacheKey(hash)
+	readCache := func() (*models.FileReport, error) {
+		if opts.ForceRefresh {
+			return nil, nil
+		}
+		key := cacheKey
+		if len(hash) != 64 {
+			sha256, ok := fileAlias(hash, redisClient)
+			if !ok {
+				return nil, nil
+			}
+			key = fileCacheKey(sha256)
+		}
+		report, err := getCachedFileReport(key, redisClient)
+		if err != nil || report == nil || !opts.isFresh(reportType, report.File.UpdatedAt, report.File.MaliciousCount, report.File.SuspiciousCount) {
+			return nil, err
+		}
+		return report, nil
+	}
+	report, err := readCache()
+	if err != nil {
+		log.Printf("Error unmarshaling cached data for ID %s: %v", hash, err)
+		return nil, err
+	}
+	if report != nil {
+		log.Printf("Redis cache hit for ID: %s", hash)
+		return report, nil
+	}
+	log.Printf("Redis cache miss for ID: %s, proceeding with API call", hash)
+
+	// Only one DB/VT fetch per indicator runs at a time, in this process and across replicas
+	return fetchOnce(opts.fetchKey(cacheKey), redisClient,
+		readCache,
+		func() (*models.FileReport, error) {
+			return loadFileReport(hash, reportType, cacheKey, db, redisClient, vtClient, opts)
+		})
+}
+
+// loadFileReport loads a fresh report from the DB, or fetches it from VirusTotal and persists it
+func loadFileReport(hash, reportType, cacheKey string, db *sqlx.DB, redisClient *redis.Client, vtClient vtclient.Client, opts FetchOptions) (*models.FileReport, error) {
+	// Check database for data within the freshness policy, unless the caller asked for a refresh
+	if !opts.ForceRefresh {
+		fileFromDB, err := repositories.GetFile(hash, db)
+		if err == nil && fileFromDB != nil {
+			if opts.isFresh(reportType, fileFromDB.UpdatedAt, fileFromDB.MaliciousCount, fileFromDB.SuspiciousCount) {
+				log.Printf("Found recent file data in DB for ID: %s, updated at: %v", hash, fileFromDB.UpdatedAt)
+				report, err := repositories.GetFileReport(fileFromDB.ID, nil, db)
+				if err != nil {
+					log.Printf("Error loading file report from DB for ID %s: %v", hash, err)
+					return nil, err
+				}
+				cacheFileReport(report, opts.cacheTTL(reportType, report.File.MaliciousCount, report.File.SuspiciousCount), redisClient)
+				return report, nil
+			}
+			if opts.serveStale(fileFromDB.UpdatedAt) {
+				log.Printf("Serving stale file data for ID: %s, updated at: %v, refreshing in the background", hash, fileFromDB.UpdatedAt)
+				report, err := repositories.GetFileReport(fileFromDB.ID, nil, db)
+				if err != nil {
+					log.Printf("Error loading file report from DB for ID %s: %v", hash, err)
+					return nil, err
+				}
+				opts.revalidate(cacheKey, reportType, hash, redisClient)
+				return report, nil
+			}
+			log.Printf("DB data for ID %s is stale (updated at: %v), proceeding with API call", hash, fileFromDB.UpdatedAt)
+		} else if err != nil {
+			log.Printf("No file data found in DB for ID %s or error: %v", hash, err)
+		}
+	}
+
+	// Skip indicators VirusTotal recently reported as unknown
+	if err := checkNotFound(cacheKey, reportType, hash, opts, db, redisClient); err != nil {
+		return nil, err
+	}
+
+	// Fetch from VirusTotal API
+	log.Printf("Making API request to VirusTotal for ID: %s", hash)
+	vtResponse, err := vtClient.GetFile(context.Background(), hash)
+	if err != nil {
+		log.Printf("Error fetching VirusTotal report for ID %s: %v", hash, err)
+		recordNotFound(err, cacheKey, reportType, hash, opts, db, redisClient)
+		return nil, err
+	}
+	log.Printf("Successfully decoded API response for ID: %s", hash)
+
+	// Files are stored under their SHA-256 whatever hash they were requested with
+	sha256 := vtResponse.Data.Attributes.SHA256
+	if sha256 == "" {
+		sha256 = vtResponse.Data.ID
+	}
+	id, err := indicator.Hash(sha256)
+	if err != nil || len(id) != 64 {
+		return nil, fmt.Errorf("VirusTotal returned no SHA-256 for file %s", hash)
+	}
+
+	// Persist in one transaction, the writer caches the report under the SHA-256 after commit
+	return NewReportWriter(db, redisClient, opts).WriteFile(id, reportType, vtResponse)
+}
+
+// fileCacheKey returns the cache key of a file hash
+func fileCacheKey(hash string) string {
+	return fmt.Sprintf("file:%s", hash)
+}
+
+// resolveFileHash returns the SHA-256 of a file requested by MD5, SHA-1 or SHA-256,
+// from its alias key or the files table. ok is false when the file is not stored yet.
+func resolveFileHash(hash string, db *sqlx.DB, redisClient *redis.Client) (string, bool) {
+	if len(hash) == 64 {
+		return hash, true
+	}
+	if sha256, ok := fileAlias(hash, redisClient); ok {
+		return sha256, true
+	}
+	file, err := repositories.GetFile(hash, db)
+	if err != nil {
+		return hash, false
+	}
+	log.Printf("Resolved file hash %s to SHA-256 %s", hash, file.ID)
+	saveFileAliases(file, redisClient)
+	return file.ID, true
+}
+
+// fileAlias returns the SHA-256 an MD5 or SHA-1 alias key points at
+func fileAlias(hash string, redisClient *redis.Client) (string, bool) {
+	sha256, err := redisClient.Get(context.Background(), fileAliasPrefix+hash)
+	if err != nil || sha256 == "" {
+		return "", false
+	}
+	return sha256, true
+}
+
+// saveFileAliases points the MD5 and SHA-1 alias keys of a file at its SHA-256
+func saveFileAliases(file *models.File, redisClient *redis.Client) {
+	for _, alias := range []*string{file.MD5, file.SHA1} {
+		if alias == nil || *alias == "" {
+			continue
+		}
+		if err := redisClient.Set(context.Background(), fileAliasPrefix+strings.ToLower(*alias), file.ID, fileAliasTTL); err != nil {
+			log.Printf("Error saving file hash alias %s: %v", *alias, err)
+		}
+	}
+}
+
+// fileFromVT converts a VirusTotal file response into the files row
+func fileFromVT(id, reportType string, vtResponse *models.VirusTotalFileResponse) *models.File {
+	attributes := vtResponse.Data.Attributes
+
+	// Get analysis stats
+	harmless := attributes.LastAnalysisStats["harmless"]
+	malicious := attributes.LastAnalysisStats["malicious"]
+	suspicious := attributes.LastAnalysisStats["suspicious"]
+	undetected := attributes.LastAnalysisStats["undetected"]
+	timeout := attributes.LastAnalysisStats["timeout"]
+
+	signatureJSON, _ := json.Marshal(attributes.SignatureInfo)
+	statsJSON, _ := json.Marshal(attributes.LastAnalysisStats)
+
+	return &models.File{
+		ID:                  id,
+		Type:                reportType,
+		MD5:                 &attributes.MD5,
+		SHA1:                &attributes.SHA1,
+		Size:                &attributes.Size,
+		TypeDescription:     &attributes.TypeDescription,
+		TypeTag:             &attributes.TypeTag,
+		MeaningfulName:      &attributes.MeaningfulName,
+		Magic:               &attributes.Magic,
+		FirstSubmissionDate: unixTime(attributes.FirstSubmissionDate),
+		LastSubmissionDate:  unixTime(attributes.LastSubmissionDate),
+		LastAnalysisDate:    unixTime(attributes.LastAnalysisDate),
+		TimesSubmitted:      &attributes.TimesSubmitted,
+		Reputation:          &attributes.Reputation,
+		SignatureInfo:       signatureJSON,
+		LastAnalysisStats:   statsJSON,
+		HarmlessCount:       &harmless,
+		MaliciousCount:      &malicious,
+		SuspiciousCount:     &suspicious,
+		UndetectedCount:     &undetected,
+		TimeoutCount:        &timeout,
+		CreatedAt:           time.Now(),
+		UpdatedAt:           time.Now(),
+	}
+}
+
+// cacheFileReport stores the full file report in Redis under its SHA-256, along with its hash aliases
+func cacheFileReport(report *models.FileReport, ttl time.Duration, redisClient *redis.Client) {
+	cacheKey := fileCacheKey(report.File.ID)
+	saveFileAliases(report.File, redisClient)
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		log.Printf("Error marshaling file report for cache: %v", err)
+		return
+	}
+	if err := redisClient.Set(context.Background(), cacheKey, reportJSON, ttl); err != nil {
+		log.Printf("Error saving to Redis cache: %v", err)
+		return
+	}
+	log.Printf("Successfully saved to Redis cache for key: %s", cacheKey)
+}
+
+// getCachedFileReport returns the cached report, or nil on a cache miss
+func getCachedFileReport(cacheKey string, redisClient *redis.Client) (*models.FileReport, error) {
+	cachedData, err := redisClient.Get(context.Background(), cacheKey)
+	if err != nil || cachedData == "" {
+		return nil, nil
+	}
+	var report models.FileReport
+	if err := json.Unmarshal([]byte(cachedData), &report); err != nil {
+		return nil, err
+	}
+	if report.File == nil {
+		return nil, nil
+	}
+	return &report, nil
+}
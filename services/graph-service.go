@@ -0,0 +1,301 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"vt-data-pipeline/indicator"
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/repositories"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// MaxGraphDepth bounds how many pivots away from the root a graph reaches
+	MaxGraphDepth = 3
+	// maxGraphNodes bounds the size of a graph so that a popular registrar or network cannot explode it
+	maxGraphNodes = 500
+	// graphPivotLimit bounds how many indicators are pulled in through one shared attribute
+	graphPivotLimit = 25
+)
+
+// ErrNotStored is returned when an indicator has not been fetched into the database yet
+var ErrNotStored = errors.New("indicator is not stored yet, fetch it with GET /report/:id first")
+
+// nodeTypes maps report and relationship types onto graph node types
+var nodeTypes = map[string]string{
+	"domains":      models.NodeDomain,
+	"ip_addresses": models.NodeIPAddress,
+	"files":        models.NodeFile,
+	"urls":         models.NodeURL,
+}
+
+// graphBuilder expands a pivot graph breadth first from the stored tables
+type graphBuilder struct {
+	db    *sqlx.DB
+	graph *models.Graph
+	nodes map[string]int
+	edges map[string]bool
+	queue []string
+}
+
+// BuildGraph builds a node/edge graph around a stored domain or IP purely from local tables:
+// DNS A/AAAA records, IP network and AS, shared registrar, shared certificate thumbprint and stored relationships
+func BuildGraph(id, reportType string, depth int, db *sqlx.DB) (*models.Graph, error) {
+	log.Printf("Starting BuildGraph for ID: %s, Type: %s, Depth: %d", id, reportType, depth)
+
+	var err error
+	switch reportType {
+	case "domains":
+		_, err = repositories.GetDomain(id, db)
+	case "ip_addresses":
+		_, err = repositories.GetIPAddress(id, db)
+	default:
+		return nil, fmt.Errorf("graph is not supported for %s", reportType)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotStored
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b := &graphBuilder{
+		db:    db,
+		graph: &models.Graph{Depth: depth, Nodes: []models.GraphNode{}, Edges: []models.GraphEdge{}},
+		nodes: map[string]int{},
+		edges: map[string]bool{},
+	}
+	b.graph.Root = b.addNode(nodeTypes[reportType], id, id, 0)
+
+	for len(b.queue) > 0 {
+		nodeID := b.queue[0]
+		b.queue = b.queue[1:]
+		if b.node(nodeID).Depth >= depth {
+			continue
+		}
+		if err := b.expand(nodeID); err != nil {
+			log.Printf("Error expanding graph node %s: %v", nodeID, err)
+			return nil, err
+		}
+	}
+
+	log.Printf("Built graph for ID %s with %d nodes and %d edges", id, len(b.graph.Nodes), len(b.graph.Edges))
+	return b.graph, nil
+}
+
+// expand adds the neighbours of a node one pivot further from the root
+func (b *graphBuilder) expand(nodeID string) error {
+	node := b.node(nodeID)
+	next := node.Depth + 1
+
+	switch node.Type {
+	case models.NodeDomain:
+		if err := b.expandDomain(nodeID, node.Label, next); err != nil {
+			return err
+		}
+		return b.expandRelationships(nodeID, "domains", node.Label, next)
+
+	case models.NodeIPAddress:
+		if err := b.expandIP(nodeID, node.Label, next); err != nil {
+			return err
+		}
+		return b.expandRelationships(nodeID, "ip_addresses", node.Label, next)
+
+	case models.NodeNetwork:
+		ips, err := repositories.GetIPsInNetwork(node.Label, graphPivotLimit, b.db)
+		if err != nil {
+			return err
+		}
+		b.markTruncated(len(ips))
+		for _, ip := range ips {
+			b.addEdge(b.addNode(models.NodeIPAddress, ip, ip, next), nodeID, "in_network")
+		}
+
+	case models.NodeAS:
+		asn, err := strconv.Atoi(strings.TrimPrefix(nodeID, models.NodeAS+":"))
+		if err != nil {
+			return nil
+		}
+		ips, err := repositories.GetIPsByASN(asn, graphPivotLimit, b.db)
+		if err != nil {
+			return err
+		}
+		b.markTruncated(len(ips))
+		for _, ip := range ips {
+			b.addEdge(b.addNode(models.NodeIPAddress, ip, ip, next), nodeID, "announced_by")
+		}
+
+	case models.NodeRegistrar:
+		domains, err := repositories.GetDomainsByRegistrar(node.Label, graphPivotLimit, b.db)
+		if err != nil {
+			return err
+		}
+		b.markTruncated(len(domains))
+		for _, domain := range domains {
+			b.addEdge(b.addNode(models.NodeDomain, domain, domain, next), nodeID, "registered_with")
+		}
+
+	case models.NodeCertificate:
+		domains, err := repositories.GetDomainsByCertificate(node.Label, graphPivotLimit, b.db)
+		if err != nil {
+			return err
+		}
+		b.markTruncated(len(domains))
+		for _, domain := range domains {
+			b.addEdge(b.addNode(models.NodeDomain, domain, domain, next), nodeID, "uses_certificate")
+		}
+
+	case models.NodeFile:
+		return b.expandRelationships(nodeID, "files", node.Label, next)
+
+	case models.NodeURL:
+		return b.expandRelationships(nodeID, "urls", node.Label, next)
+	}
+	return nil
+}
+
+// expandDomain pivots from a domain to its A/AAAA records, registrar and certificate
+func (b *graphBuilder) expandDomain(nodeID, id string, next int) error {
+	domain, err := repositories.GetDomain(id, b.db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b.node(nodeID).Data = map[string]any{
+		"reputation":       domain.Reputation,
+		"malicious_count":  domain.MaliciousCount,
+		"suspicious_count": domain.SuspiciousCount,
+	}
+
+	if domain.Registrar != nil && *domain.Registrar != "" {
+		b.addEdge(nodeID, b.addNode(models.NodeRegistrar, *domain.Registrar, *domain.Registrar, next), "registered_with")
+	}
+
+	details, err := repositories.GetDomainDetails(id, b.db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var records []models.DNSRecord
+	if err := json.Unmarshal(details.LastDNSRecords, &records); err != nil {
+		log.Printf("Error decoding DNS records of %s: %v", id, err)
+	}
+	for _, record := range records {
+		if record.Type == "A" || record.Type == "AAAA" {
+			ip := indicator.Addr(record.Value)
+			b.addEdge(nodeID, b.addNode(models.NodeIPAddress, ip, ip, next), "resolves_to")
+		}
+	}
+
+	var certificate struct {
+		Thumbprint string `json:"thumbprint_sha256"`
+	}
+	if err := json.Unmarshal(details.LastHTTPSCertificate, &certificate); err == nil && certificate.Thumbprint != "" {
+		b.addEdge(nodeID, b.addNode(models.NodeCertificate, certificate.Thumbprint, certificate.Thumbprint, next), "uses_certificate")
+	}
+	return nil
+}
+
+// expandIP pivots from an IP to its network, AS and the domains resolving to it
+func (b *graphBuilder) expandIP(nodeID, id string, next int) error {
+	ip, err := repositories.GetIPAddress(id, b.db)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if ip != nil {
+		b.node(nodeID).Data = map[string]any{
+			"reputation":       ip.Reputation,
+			"malicious_count":  ip.MaliciousCount,
+			"suspicious_count": ip.SuspiciousCount,
+			"country":          ip.Country,
+		}
+		if ip.Network != nil && *ip.Network != "" {
+			b.addEdge(nodeID, b.addNode(models.NodeNetwork, *ip.Network, *ip.Network, next), "in_network")
+		}
+		if ip.ASN != nil && *ip.ASN != 0 {
+			label := "AS" + strconv.Itoa(*ip.ASN)
+			if ip.ASOwner != nil && *ip.ASOwner != "" {
+				label += " " + *ip.ASOwner
+			}
+			b.addEdge(nodeID, b.addNode(models.NodeAS, strconv.Itoa(*ip.ASN), label, next), "announced_by")
+		}
+	}
+
+	domains, err := repositories.GetDomainsResolvingTo(id, graphPivotLimit, b.db)
+	if err != nil {
+		return err
+	}
+	b.markTruncated(len(domains))
+	for _, domain := range domains {
+		b.addEdge(b.addNode(models.NodeDomain, domain, domain, next), nodeID, "resolves_to")
+	}
+	return nil
+}
+
+// expandRelationships follows the stored relationship edges of an indicator in both directions
+func (b *graphBuilder) expandRelationships(nodeID, indicatorType, id string, next int) error {
+	edges, err := repositories.GetRelationshipsTouching(indicatorType, id, graphPivotLimit, b.db)
+	if err != nil {
+		return err
+	}
+	b.markTruncated(len(edges))
+	for _, edge := range edges {
+		source := b.addNode(nodeTypes[edge.SourceType], edge.SourceID, edge.SourceID, next)
+		target := b.addNode(nodeTypes[edge.TargetType], edge.TargetID, edge.TargetID, next)
+		b.addEdge(source, target, edge.Relation)
+	}
+	return nil
+}
+
+// addNode adds a node unless it exists and returns its id, or "" once the graph is full
+func (b *graphBuilder) addNode(nodeType, value, label string, depth int) string {
+	id := nodeType + ":" + value
+	if _, ok := b.nodes[id]; ok {
+		return id
+	}
+	if len(b.graph.Nodes) >= maxGraphNodes {
+		b.graph.Truncated = true
+		return ""
+	}
+	b.nodes[id] = len(b.graph.Nodes)
+	b.graph.Nodes = append(b.graph.Nodes, models.GraphNode{ID: id, Type: nodeType, Label: label, Depth: depth})
+	b.queue = append(b.queue, id)
+	return id
+}
+
+// addEdge adds an edge between two existing nodes once
+func (b *graphBuilder) addEdge(source, target, relation string) {
+	if source == "" || target == "" || source == target {
+		return
+	}
+	key := source + "|" + target + "|" + relation
+	if b.edges[key] {
+		return
+	}
+	b.edges[key] = true
+	b.graph.Edges = append(b.graph.Edges, models.GraphEdge{Source: source, Target: target, Relation: relation})
+}
+
+// node returns the node with the given id
+func (b *graphBuilder) node(id string) *models.GraphNode {
+	return &b.graph.Nodes[b.nodes[id]]
+}
+
+// markTruncated flags the graph when a pivot may have had more results than it pulled in
+func (b *graphBuilder) markTruncated(n int) {
+	if n >= graphPivotLimit {
+		b.graph.Truncated = true
+	}
+}
@@ -5,88 +5,104 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
-	"sync"
 	"time"
-	"vt-data-pipeline/config"
+	"vt-data-pipeline/indicator"
 	"vt-data-pipeline/models"
 	"vt-data-pipeline/redis"
 	"vt-data-pipeline/repositories"
+	"vt-data-pipeline/vtclient"
 
 	"github.com/jmoiron/sqlx"
 )
 
-func FetchIPReport(id, reportType string, db *sqlx.DB, redisClient *redis.Client, cfg *config.Config) (*models.IPAddress, error) {
+func FetchIPReport(id, reportType string, db *sqlx.DB, redisClient *redis.Client, vtClient vtclient.Client, opts FetchOptions) (*models.IPReport, error) {
 	log.Printf("Starting FetchIPReport for ID: %s, Type: %s", id, reportType)
 
-	// Check Redis cache first
+	// Check Redis cache first, unless the caller asked for a refresh or a tighter max age
 	cacheKey := fmt.Sprintf("ip:%s", id)
-	cachedData, err := redisClient.Get(context.Background(), cacheKey)
-	if err == nil && cachedData != "" {
-		log.Printf("Redis cache hit for ID: %s", id)
-		var ip models.IPAddress
-		if err := json.Unmarshal([]byte(cachedData), &ip); err != nil {
-			log.Printf("Error unmarshaling cached data for ID %s: %v", id, err)
+	readCache := func() (*models.IPReport, error) {
+		if opts.ForceRefresh {
+			return nil, nil
+		}
+		report, err := getCachedIPReport(cacheKey, redisClient)
+		if err != nil || report == nil || !opts.isFresh(reportType, report.IP.UpdatedAt, report.IP.MaliciousCount, report.IP.SuspiciousCount) {
 			return nil, err
 		}
-		return &ip, nil
+		return report, nil
+	}
+	report, err := readCache()
+	if err != nil {
+		log.Printf("Error unmarshaling cached data for ID %s: %v", id, err)
+		return nil, err
+	}
+	if report != nil {
+		log.Printf("Redis cache hit for ID: %s", id)
+		return report, nil
 	}
 	log.Printf("Redis cache miss for ID: %s, proceeding with API call", id)
 
-	// Check database for recent data (updated within last 24 hours)
-	IPFromDB, err := repositories.GetIPAddress(id, db)
-	if err == nil && IPFromDB != nil {
-		if time.Since(IPFromDB.UpdatedAt) < 24*time.Hour {
-			log.Printf("Found recent IP data in DB for ID: %s, updated at: %v", id, IPFromDB.UpdatedAt)
-			ipJSON, err := json.Marshal(IPFromDB)
-			if err != nil {
-				log.Printf("Error marshaling IP for cache: %v", err)
-			} else {
-				if err := redisClient.Set(context.Background(), cacheKey, ipJSON, time.Hour); err != nil {
-					log.Printf("Error saving to Redis cache: %v", err)
-				} else {
-					log.Printf("Successfully saved to Redis cache for ID: %s", id)
+	// Only one DB/VT fetch per indicator runs at a time, in this process and across replicas
+	return fetchOnce(opts.fetchKey(cacheKey), redisClient,
+		readCache,
+		func() (*models.IPReport, error) {
+			return loadIPReport(id, reportType, cacheKey, db, redisClient, vtClient, opts)
+		})
+}
+
+// loadIPReport loads a fresh report from the DB, or fetches it from VirusTotal and persists it
+func loadIPReport(id, reportType, cacheKey string, db *sqlx.DB, redisClient *redis.Client, vtClient vtclient.Client, opts FetchOptions) (*models.IPReport, error) {
+	// Check database for data within the freshness policy, unless the caller asked for a refresh
+	if !opts.ForceRefresh {
+		IPFromDB, err := repositories.GetIPAddress(id, db)
+		if err == nil && IPFromDB != nil {
+			if opts.isFresh(reportType, IPFromDB.UpdatedAt, IPFromDB.MaliciousCount, IPFromDB.SuspiciousCount) {
+				log.Printf("Found recent IP data in DB for ID: %s, updated at: %v", id, IPFromDB.UpdatedAt)
+				report, err := repositories.GetIPReport(id, nil, db)
+				if err != nil {
+					log.Printf("Error loading IP report from DB for ID %s: %v", id, err)
+					return nil, err
 				}
+				cacheIPReport(cacheKey, report, opts.cacheTTL(reportType, report.IP.MaliciousCount, report.IP.SuspiciousCount), redisClient)
+				return report, nil
 			}
-			return IPFromDB, nil
+			if opts.serveStale(IPFromDB.UpdatedAt) {
+				log.Printf("Serving stale IP data for ID: %s, updated at: %v, refreshing in the background", id, IPFromDB.UpdatedAt)
+				report, err := repositories.GetIPReport(id, nil, db)
+				if err != nil {
+					log.Printf("Error loading IP report from DB for ID %s: %v", id, err)
+					return nil, err
+				}
+				opts.revalidate(cacheKey, reportType, id, redisClient)
+				return report, nil
+			}
+			log.Printf("DB data for ID %s is stale (updated at: %v), proceeding with API call", id, IPFromDB.UpdatedAt)
+		} else if err != nil {
+			log.Printf("No IP data found in DB for ID %s or error: %v", id, err)
 		}
-		log.Printf("DB data for ID %s is stale (updated at: %v), proceeding with API call", id, IPFromDB.UpdatedAt)
-	} else if err != nil {
-		log.Printf("No IP data found in DB for ID %s or error: %v", id, err)
 	}
-	log.Printf("Proceeding with VirusTotal API call for ID: %s", id)
 
-	// Fetch from VirusTotal API
-	url := fmt.Sprintf("https://www.virustotal.com/api/v3/%s/%s", reportType, id)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("x-apikey", cfg.VirusTotal.APIKey)
-
-	client := &http.Client{}
-	log.Printf("Making API request to VirusTotal for ID: %s", id)
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Error making API request for ID %s: %v", id, err)
+	// Skip indicators VirusTotal recently reported as unknown
+	if err := checkNotFound(cacheKey, reportType, id, opts, db, redisClient); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	log.Printf("Proceeding with VirusTotal API call for ID: %s", id)
 
-	// Parse API response
-	var vtResponse models.VirusTotalIPResponse
-	err = json.NewDecoder(resp.Body).Decode(&vtResponse)
+	// Fetch from VirusTotal API
+	log.Printf("Making API request to VirusTotal for ID: %s", id)
+	vtResponse, err := vtClient.GetIP(context.Background(), id)
 	if err != nil {
-		log.Printf("Error decoding API response for ID %s: %v", id, err)
+		log.Printf("Error fetching VirusTotal report for ID %s: %v", id, err)
+		recordNotFound(err, cacheKey, reportType, id, opts, db, redisClient)
 		return nil, err
 	}
 	log.Printf("Successfully decoded API response for ID: %s", id)
 
-	// Begin transaction
-	tx, err := db.Beginx()
-	if err != nil {
-		log.Printf("Error beginning transaction for ID %s: %v", id, err)
-		return nil, err
-	}
-	defer tx.Rollback()
+	// Persist in one transaction, the writer caches the report after commit
+	return NewReportWriter(db, redisClient, opts).WriteIP(id, reportType, cacheKey, vtResponse)
+}
 
+// ipFromVT converts a VirusTotal IP response into the ip_addresses and ip_details rows
+func ipFromVT(id, reportType string, vtResponse *models.VirusTotalIPResponse) (*models.IPAddress, *models.IPDetails) {
 	// Convert timestamps
 	var lastAnalysisDate, whoisDate, lastModificationDate *time.Time
 	if vtResponse.Data.Attributes.LastAnalysisDate != 0 {
@@ -109,6 +125,17 @@ func FetchIPReport(id, reportType string, db *sqlx.DB, redisClient *redis.Client
 	undetected := vtResponse.Data.Attributes.LastAnalysisStats["undetected"]
 	timeout := vtResponse.Data.Attributes.LastAnalysisStats["timeout"]
 
+	// Store the network masked and canonical, the cidr column rejects empty strings and host bits
+	var network *string
+	if vtResponse.Data.Attributes.Network != "" {
+		if prefix, err := indicator.Network(vtResponse.Data.Attributes.Network); err == nil {
+			masked := prefix.String()
+			network = &masked
+		} else {
+			log.Printf("Ignoring invalid network %q for ID %s: %v", vtResponse.Data.Attributes.Network, id, err)
+		}
+	}
+
 	// Create IP object
 	ip := &models.IPAddress{
 		ID:                       id,
@@ -119,7 +146,7 @@ func FetchIPReport(id, reportType string, db *sqlx.DB, redisClient *redis.Client
 		Country:                  &vtResponse.Data.Attributes.Country,
 		ASOwner:                  &vtResponse.Data.Attributes.ASOwner,
 		RegionalInternetRegistry: &vtResponse.Data.Attributes.RegionalInternetRegistry,
-		Network:                  &vtResponse.Data.Attributes.Network,
+		Network:                  network,
 		WhoisDate:                whoisDate,
 		LastModificationDate:     lastModificationDate,
 		Continent:                &vtResponse.Data.Attributes.Continent,
@@ -132,14 +159,7 @@ func FetchIPReport(id, reportType string, db *sqlx.DB, redisClient *redis.Client
 		UpdatedAt:                time.Now(),
 	}
 
-	// Save IP data
-	if err := repositories.SaveIPAddress(tx, ip); err != nil {
-		log.Printf("Error saving IP data for ID %s: %v", id, err)
-		return nil, err
-	}
-	log.Printf("Successfully saved IP data for ID: %s", id)
-
-	// Save IP details
+	// Collect IP details
 	votesJSON, _ := json.Marshal(vtResponse.Data.Attributes.TotalVotes)
 	details := &models.IPDetails{
 		IPID:       id,
@@ -147,68 +167,36 @@ func FetchIPReport(id, reportType string, db *sqlx.DB, redisClient *redis.Client
 		TotalVotes: votesJSON,
 	}
 
-	if err := repositories.SaveIPDetails(tx, details); err != nil {
-		log.Printf("Error saving IP details for ID %s: %v", id, err)
-		return nil, err
-	}
-	log.Printf("Successfully saved IP details for ID: %s", id)
-
-	// Go routine for insert tags and analysis
-	errChan := make(chan error, 2)
-	var wg sync.WaitGroup
-
-	// Save tags
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := repositories.SaveIPTags(tx, id, vtResponse.Data.Attributes.Tags); err != nil {
-			log.Printf("Error saving tags for ID %s: %v", id, err)
-			errChan <- err
-			return
-		}
-		log.Printf("Successfully saved tags for ID: %s", id)
-	}()
-
-	// Save analysis results
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := repositories.SaveIPAnalysisResults(tx, id, vtResponse.Data.Attributes.LastAnalysisResults); err != nil {
-			log.Printf("Error saving analysis results for ID %s: %v", id, err)
-			errChan <- err
-			return
-		}
-		log.Printf("Successfully saved analysis results for ID: %s", id)
-	}()
-
-	wg.Wait()
-	close(errChan)
-
-	// Check for any errors
-	for err := range errChan {
-		if err != nil {
-			return nil, err
-		}
-	}
+	return ip, details
+}
 
-	// Save to Redis cache
-	ipJSON, err := json.Marshal(ip)
+// cacheIPReport stores the full IP report in Redis
+func cacheIPReport(cacheKey string, report *models.IPReport, ttl time.Duration, redisClient *redis.Client) {
+	reportJSON, err := json.Marshal(report)
 	if err != nil {
-		log.Printf("Error marshaling IP for cache: %v", err)
-	} else {
-		if err := redisClient.Set(context.Background(), cacheKey, ipJSON, time.Hour); err != nil {
-			log.Printf("Error saving to Redis cache: %v", err)
-		} else {
-			log.Printf("Successfully saved to Redis cache for ID: %s", id)
-		}
+		log.Printf("Error marshaling IP report for cache: %v", err)
+		return
 	}
+	if err := redisClient.Set(context.Background(), cacheKey, reportJSON, ttl); err != nil {
+		log.Printf("Error saving to Redis cache: %v", err)
+		return
+	}
+	log.Printf("Successfully saved to Redis cache for key: %s", cacheKey)
+}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction for ID %s: %v", id, err)
+// getCachedIPReport returns the cached report, or nil on a cache miss
+func getCachedIPReport(cacheKey string, redisClient *redis.Client) (*models.IPReport, error) {
+	cachedData, err := redisClient.Get(context.Background(), cacheKey)
+	if err != nil || cachedData == "" {
+		return nil, nil
+	}
+	var report models.IPReport
+	if err := json.Unmarshal([]byte(cachedData), &report); err != nil {
 		return nil, err
 	}
-	log.Printf("Successfully committed transaction for ID: %s", id)
-
-	return ip, nil
+	if report.IP == nil {
+		log.Printf("Cached data for key %s predates the full report format, ignoring it", cacheKey)
+		return nil, nil
+	}
+	return &report, nil
 }
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"vt-data-pipeline/config"
+	"vt-data-pipeline/indicator"
+	"vt-data-pipeline/jobs"
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/ratelimit"
+	"vt-data-pipeline/redis"
+	"vt-data-pipeline/vtclient"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrUnsupportedType is returned for report types other than domains, ip_addresses, urls and files
+var ErrUnsupportedType = errors.New("type must be domains, ip_addresses, urls or files")
+
+// FetchReport fetches a report of any type through the same path as GET /report/:id
+func FetchReport(id, reportType string, db *sqlx.DB, redisClient *redis.Client, vtClient vtclient.Client, opts FetchOptions) (any, error) {
+	switch reportType {
+	case "domains":
+		return FetchDomainVTReport(id, reportType, db, redisClient, vtClient, opts)
+	case "ip_addresses":
+		return FetchIPReport(id, reportType, db, redisClient, vtClient, opts)
+	case "urls":
+		return FetchURLReport(id, reportType, db, redisClient, vtClient, opts)
+	case "files":
+		return FetchFileReport(id, reportType, db, redisClient, vtClient, opts)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, reportType)
+}
+
+// FetchJobHandler returns the queue handler that runs asynchronous report fetches.
+// Errors that a retry cannot fix are marked permanent, everything else is retried by the queue.
+// Refresh jobs skip the cache and DB. Only jobs queued by the watchlist scheduler are checked for alerts
+// once the new snapshot is written, refreshes forced through the API or by revalidation are not.
+func FetchJobHandler(db *sqlx.DB, redisClient *redis.Client, vtClient vtclient.Client, notifier *AlertNotifier, freshness config.FreshnessPolicy) jobs.Handler {
+	return func(ctx context.Context, job *models.Job) (any, error) {
+		log.Printf("Running job %s for ID: %s, Type: %s, attempt %d", job.ID, job.Indicator, job.Type, job.Attempts)
+
+		opts := FetchOptions{Freshness: freshness, ForceRefresh: job.Refresh}
+		report, err := FetchReport(job.Indicator, job.Type, db, redisClient, vtClient, opts)
+		// A scheduled refresh stops counting against the watchlist budget once its VT request is in the used quota,
+		// i.e. unless it is still waiting for quota
+		var quotaErr *ratelimit.QuotaExhaustedError
+		if job.Scheduled && !errors.As(err, &quotaErr) {
+			finishScheduledRefresh(ctx, job.ID, redisClient)
+		}
+		if err == nil && job.Scheduled && notifier != nil {
+			if _, alertErr := notifier.Evaluate(ctx, job.Indicator, job.Type); alertErr != nil {
+				log.Printf("Error evaluating alerts for ID %s: %v", job.Indicator, alertErr)
+			}
+		}
+		if errors.Is(err, vtclient.ErrNotFound) || errors.Is(err, indicator.ErrInvalid) || errors.Is(err, ErrUnsupportedType) {
+			return nil, jobs.Permanent(err)
+		}
+		return report, err
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"vt-data-pipeline/redis"
+	"vt-data-pipeline/repositories"
+	"vt-data-pipeline/vtclient"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// notFoundKeyPrefix prefixes the cache key of indicators VirusTotal reported as unknown
+const notFoundKeyPrefix = "notfound:"
+
+var (
+	negativeCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vt_negative_cache_hits_total",
+		Help: "Lookups answered from the negative cache instead of VirusTotal.",
+	}, []string{"type", "source"})
+	negativeCacheStores = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "vt_negative_cache_stores_total",
+		Help: "NotFoundError responses from VirusTotal recorded in the negative cache.",
+	}, []string{"type"})
+	negativeCacheEntries = prometheus.NewDesc("vt_negative_cache_entries", "Unexpired entries in not_found_indicators.", nil, nil)
+)
+
+// NotFoundCachedError is returned for indicators VirusTotal reported as unknown within the negative cache TTL.
+// It unwraps to vtclient.ErrNotFound, so callers treat it like a fresh NotFoundError.
+type NotFoundCachedError struct {
+	Until time.Time
+}
+
+func (e *NotFoundCachedError) Error() string {
+	return "indicator not found on VirusTotal (cached until " + e.Until.UTC().Format(time.RFC3339) + ")"
+}
+
+func (e *NotFoundCachedError) Unwrap() error { return vtclient.ErrNotFound }
+
+// RegisterNegativeCacheMetrics exposes the number of unexpired negative cache entries. Call it once per process.
+func RegisterNegativeCacheMetrics(db *sqlx.DB) {
+	prometheus.MustRegister(negativeCacheCollector{db: db})
+}
+
+// negativeCacheCollector counts the negative cache entries at scrape time. A scrape where the count fails leaves the gauge out.
+type negativeCacheCollector struct {
+	db *sqlx.DB
+}
+
+func (c negativeCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- negativeCacheEntries
+}
+
+func (c negativeCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	count, err := repositories.CountNotFoundIndicators(c.db)
+	if err != nil {
+		log.Printf("Error counting negative cache entries: %v", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(negativeCacheEntries, prometheus.GaugeValue, float64(count))
+}
+
+// checkNotFound returns a NotFoundCachedError when VirusTotal recently reported the indicator as unknown.
+// Redis is checked first, the table catches entries Redis lost. ForceRefresh skips both.
+func checkNotFound(cacheKey, reportType, id string, opts FetchOptions, db *sqlx.DB, redisClient *redis.Client) error {
+	if opts.ForceRefresh {
+		return nil
+	}
+	ctx := context.Background()
+
+	if cached, err := redisClient.Get(ctx, notFoundKeyPrefix+cacheKey); err == nil && cached != "" {
+		until, _ := time.Parse(time.RFC3339, cached)
+		log.Printf("Negative cache hit in Redis for ID: %s", id)
+		negativeCacheHits.WithLabelValues(reportType, "redis").Inc()
+		return &NotFoundCachedError{Until: until}
+	}
+
+	entry, err := repositories.GetNotFoundIndicator(id, reportType, db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error checking negative cache for ID %s: %v", id, err)
+		return nil
+	}
+	log.Printf("Negative cache hit in DB for ID: %s, expires at: %v", id, entry.ExpiresAt)
+	negativeCacheHits.WithLabelValues(reportType, "db").Inc()
+	if err := redisClient.Set(ctx, notFoundKeyPrefix+cacheKey, entry.ExpiresAt.UTC().Format(time.RFC3339), time.Until(entry.ExpiresAt)); err != nil {
+		log.Printf("Error restoring negative cache for key %s: %v", cacheKey, err)
+	}
+	return &NotFoundCachedError{Until: entry.ExpiresAt}
+}
+
+// recordNotFound stores a NotFoundError from VirusTotal in Redis and not_found_indicators
+func recordNotFound(err error, cacheKey, reportType, id string, opts FetchOptions, db *sqlx.DB, redisClient *redis.Client) {
+	if !errors.Is(err, vtclient.ErrNotFound) {
+		return
+	}
+	ttl := opts.Freshness.NotFoundTTLFor()
+	entry, saveErr := repositories.SaveNotFoundIndicator(id, reportType, ttl, db)
+	if saveErr != nil {
+		log.Printf("Error saving negative cache entry for ID %s: %v", id, saveErr)
+	}
+	until := time.Now().Add(ttl)
+	if entry != nil {
+		until = entry.ExpiresAt
+	}
+	if setErr := redisClient.Set(context.Background(), notFoundKeyPrefix+cacheKey, until.UTC().Format(time.RFC3339), ttl); setErr != nil {
+		log.Printf("Error saving negative cache entry to Redis for key %s: %v", cacheKey, setErr)
+	}
+	negativeCacheStores.WithLabelValues(reportType).Inc()
+	log.Printf("Recorded ID %s as not found on VirusTotal until %v", id, until)
+}
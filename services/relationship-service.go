@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"vt-data-pipeline/indicator"
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/redis"
+	"vt-data-pipeline/repositories"
+	"vt-data-pipeline/vtclient"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// relationshipPageSize is the largest page VirusTotal serves for relationships
+	relationshipPageSize = 40
+	// MaxRelationshipPages caps how many VT pages one ingest may spend quota on
+	MaxRelationshipPages = 10
+)
+
+// ErrUnsupportedRelationship is returned for relationships the pipeline does not ingest
+var ErrUnsupportedRelationship = errors.New("unsupported relationship")
+
+// relationshipTargets maps source type and relationship name to the type of the related indicators
+var relationshipTargets = map[string]map[string]string{
+	"domains": {
+		"resolutions":         "ip_addresses",
+		"subdomains":          "domains",
+		"communicating_files": "files",
+		"referrer_files":      "files",
+		"urls":                "urls",
+	},
+	"ip_addresses": {
+		"resolutions":         "domains",
+		"communicating_files": "files",
+		"referrer_files":      "files",
+		"urls":                "urls",
+	},
+}
+
+// FetchRelationships returns stored edges of one relationship of an indicator.
+// Edges are (re)ingested from VirusTotal, following up to pages cursor pages, when they were not fetched within the last 24 hours.
+func FetchRelationships(id, reportType, relation string, pages, limit, offset int, db *sqlx.DB, redisClient *redis.Client, vtClient vtclient.Client) ([]models.Relationship, error) {
+	log.Printf("Starting FetchRelationships for ID: %s, Type: %s, Relation: %s", id, reportType, relation)
+
+	targetType, ok := relationshipTargets[reportType][relation]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s for %s", ErrUnsupportedRelationship, relation, reportType)
+	}
+
+	// recentFetch returns when the relationship was ingested, or nil when that was more than 24 hours ago
+	recentFetch := func() (*time.Time, error) {
+		fetch, err := repositories.GetRelationshipFetch(reportType, id, relation, db)
+		if err != nil || time.Since(fetch.FetchedAt) >= 24*time.Hour {
+			return nil, nil
+		}
+		return &fetch.FetchedAt, nil
+	}
+
+	fetchedAt, _ := recentFetch()
+	if fetchedAt == nil {
+		// Only one ingest per indicator and relationship runs at a time, in this process and across replicas
+		lockKey := fmt.Sprintf("rel:%s:%s:%s", reportType, id, relation)
+		_, err := fetchOnce(lockKey, redisClient, recentFetch, func() (*time.Time, error) {
+			if err := ingestRelationships(id, reportType, relation, targetType, pages, db, vtClient); err != nil {
+				return nil, err
+			}
+			now := time.Now()
+			return &now, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		log.Printf("Found recent %s relationships in DB for ID: %s, fetched at: %v", relation, id, *fetchedAt)
+	}
+
+	edges, err := repositories.GetRelationships(reportType, id, relation, limit, offset, db)
+	if err != nil {
+		log.Printf("Error loading relationships from DB for ID %s: %v", id, err)
+		return nil, err
+	}
+	return edges, nil
+}
+
+// ingestRelationships pages through a VirusTotal relationship and stores the edges in one transaction
+func ingestRelationships(id, reportType, relation, targetType string, pages int, db *sqlx.DB, vtClient vtclient.Client) error {
+	pages = max(1, min(pages, MaxRelationshipPages))
+
+	var edges []models.Relationship
+	// Index of each target in edges, a target may show up several times (e.g. resolutions on different dates)
+	seen := map[string]int{}
+	cursor := ""
+	for page := 0; page < pages; page++ {
+		log.Printf("Making API request to VirusTotal for %s of ID: %s, page: %d", relation, id, page+1)
+		response, err := vtClient.GetRelationship(context.Background(), reportType, id, relation, cursor, relationshipPageSize)
+		if err != nil {
+			log.Printf("Error fetching %s for ID %s: %v", relation, id, err)
+			return err
+		}
+
+		now := time.Now()
+		for _, object := range response.Data {
+			edge := models.Relationship{
+				SourceType: reportType,
+				SourceID:   id,
+				Relation:   relation,
+				TargetType: targetType,
+				TargetID:   object.ID,
+			}
+
+			seenAt := &now
+			switch targetType {
+			case "ip_addresses":
+				edge.TargetID = indicator.Addr(object.Attributes.IPAddress)
+			case "domains":
+				if relation == "resolutions" {
+					edge.TargetID = object.Attributes.HostName
+				}
+			case "urls":
+				// Store URLs under the identifier the urls table uses
+				if object.Attributes.URL != "" {
+					edge.TargetID = vtclient.URLIdentifier(object.Attributes.URL)
+				}
+			}
+			if relation == "resolutions" && object.Attributes.Date != 0 {
+				seenAt = unixTime(object.Attributes.Date)
+			}
+			edge.FirstSeen, edge.LastSeen = seenAt, seenAt
+
+			if edge.TargetID == "" {
+				continue
+			}
+			if i, ok := seen[edge.TargetID]; ok {
+				if edges[i].FirstSeen.After(*seenAt) {
+					edges[i].FirstSeen = seenAt
+				}
+				if edges[i].LastSeen.Before(*seenAt) {
+					edges[i].LastSeen = seenAt
+				}
+				continue
+			}
+			seen[edge.TargetID] = len(edges)
+			edges = append(edges, edge)
+		}
+
+		cursor = response.Meta.Cursor
+		if cursor == "" {
+			break
+		}
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		log.Printf("Error beginning transaction for ID %s: %v", id, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := repositories.SaveRelationships(tx, edges); err != nil {
+		log.Printf("Error saving %s for ID %s: %v", relation, id, err)
+		return err
+	}
+	if err := repositories.SaveRelationshipFetch(tx, reportType, id, relation); err != nil {
+		log.Printf("Error recording %s fetch for ID %s: %v", relation, id, err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction for ID %s: %v", id, err)
+		return err
+	}
+	log.Printf("Successfully saved %d %s edges for ID: %s", len(edges), relation, id)
+	return nil
+}
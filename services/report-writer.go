@@ -0,0 +1,206 @@
+package services
+
+import (
+	"log"
+
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/redis"
+	"vt-data-pipeline/repositories"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ReportWriter persists a VirusTotal report into the normalized tables.
+// All writes run sequentially on one transaction, engine results are streamed with COPY,
+// domain and IP fetches also append a history snapshot, and the report is cached only after the transaction has committed,
+// with the TTL the freshness policy gives its verdict.
+type ReportWriter struct {
+	db          *sqlx.DB
+	redisClient *redis.Client
+	opts        FetchOptions
+}
+
+// NewReportWriter creates a new ReportWriter instance
+func NewReportWriter(db *sqlx.DB, redisClient *redis.Client, opts FetchOptions) *ReportWriter {
+	return &ReportWriter{
+		db:          db,
+		redisClient: redisClient,
+		opts:        opts,
+	}
+}
+
+// WriteDomain saves a domain report and returns it as read back from the DB
+func (w *ReportWriter) WriteDomain(id, reportType, cacheKey string, vtResponse *models.VirusTotalDomainResponse) (*models.DomainReport, error) {
+	domain, details := domainFromVT(id, reportType, vtResponse)
+
+	tx, err := w.db.Beginx()
+	if err != nil {
+		log.Printf("Error beginning transaction for ID %s: %v", id, err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := repositories.SaveDomain(tx, domain); err != nil {
+		log.Printf("Error saving domain data for ID %s: %v", id, err)
+		return nil, err
+	}
+	if err := repositories.SaveDomainDetails(tx, details); err != nil {
+		log.Printf("Error saving domain details for ID %s: %v", id, err)
+		return nil, err
+	}
+	if err := repositories.SaveDomainCategories(tx, id, vtResponse.Data.Attributes.Categories); err != nil {
+		log.Printf("Error saving categories for ID %s: %v", id, err)
+		return nil, err
+	}
+	if err := repositories.SaveDomainAnalysisResults(tx, id, vtResponse.Data.Attributes.LastAnalysisResults); err != nil {
+		log.Printf("Error saving analysis results for ID %s: %v", id, err)
+		return nil, err
+	}
+	if err := repositories.SaveDomainSnapshot(tx, domainSnapshot(domain, details, vtResponse)); err != nil {
+		log.Printf("Error saving domain snapshot for ID %s: %v", id, err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction for ID %s: %v", id, err)
+		return nil, err
+	}
+	log.Printf("Successfully committed domain report for ID: %s", id)
+
+	// Read back the normalized report so cache and DB responses have the same shape
+	report, err := repositories.GetDomainReport(id, nil, w.db)
+	if err != nil {
+		log.Printf("Error loading domain report from DB for ID %s: %v", id, err)
+		return nil, err
+	}
+	cacheDomainReport(cacheKey, report, w.opts.cacheTTL(reportType, report.Domain.MaliciousCount, report.Domain.SuspiciousCount), w.redisClient)
+	return report, nil
+}
+
+// WriteIP saves an IP report and returns it as read back from the DB
+func (w *ReportWriter) WriteIP(id, reportType, cacheKey string, vtResponse *models.VirusTotalIPResponse) (*models.IPReport, error) {
+	ip, details := ipFromVT(id, reportType, vtResponse)
+
+	tx, err := w.db.Beginx()
+	if err != nil {
+		log.Printf("Error beginning transaction for ID %s: %v", id, err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := repositories.SaveIPAddress(tx, ip); err != nil {
+		log.Printf("Error saving IP data for ID %s: %v", id, err)
+		return nil, err
+	}
+	if err := repositories.SaveIPDetails(tx, details); err != nil {
+		log.Printf("Error saving IP details for ID %s: %v", id, err)
+		return nil, err
+	}
+	if err := repositories.SaveIPTags(tx, id, vtResponse.Data.Attributes.Tags); err != nil {
+		log.Printf("Error saving tags for ID %s: %v", id, err)
+		return nil, err
+	}
+	if err := repositories.SaveIPAnalysisResults(tx, id, vtResponse.Data.Attributes.LastAnalysisResults); err != nil {
+		log.Printf("Error saving analysis results for ID %s: %v", id, err)
+		return nil, err
+	}
+	if err := repositories.SaveIPSnapshot(tx, ipSnapshot(ip, vtResponse)); err != nil {
+		log.Printf("Error saving IP snapshot for ID %s: %v", id, err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction for ID %s: %v", id, err)
+		return nil, err
+	}
+	log.Printf("Successfully committed IP report for ID: %s", id)
+
+	// Read back the normalized report so cache and DB responses have the same shape
+	report, err := repositories.GetIPReport(id, nil, w.db)
+	if err != nil {
+		log.Printf("Error loading IP report from DB for ID %s: %v", id, err)
+		return nil, err
+	}
+	cacheIPReport(cacheKey, report, w.opts.cacheTTL(reportType, report.IP.MaliciousCount, report.IP.SuspiciousCount), w.redisClient)
+	return report, nil
+}
+
+// WriteURL saves a URL report and returns it as read back from the DB
+func (w *ReportWriter) WriteURL(id, reportType, cacheKey string, vtResponse *models.VirusTotalURLResponse) (*models.URLReport, error) {
+	url, details := urlFromVT(id, reportType, vtResponse)
+
+	tx, err := w.db.Beginx()
+	if err != nil {
+		log.Printf("Error beginning transaction for ID %s: %v", id, err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := repositories.SaveURL(tx, url); err != nil {
+		log.Printf("Error saving URL data for ID %s: %v", id, err)
+		return nil, err
+	}
+	if err := repositories.SaveURLDetails(tx, details); err != nil {
+		log.Printf("Error saving URL details for ID %s: %v", id, err)
+		return nil, err
+	}
+	if err := repositories.SaveURLAnalysisResults(tx, id, vtResponse.Data.Attributes.LastAnalysisResults); err != nil {
+		log.Printf("Error saving analysis results for ID %s: %v", id, err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction for ID %s: %v", id, err)
+		return nil, err
+	}
+	log.Printf("Successfully committed URL report for ID: %s", id)
+
+	// Read back the normalized report so cache and DB responses have the same shape
+	report, err := repositories.GetURLReport(id, nil, w.db)
+	if err != nil {
+		log.Printf("Error loading URL report from DB for ID %s: %v", id, err)
+		return nil, err
+	}
+	cacheURLReport(cacheKey, report, w.opts.cacheTTL(reportType, report.URL.MaliciousCount, report.URL.SuspiciousCount), w.redisClient)
+	return report, nil
+}
+
+// WriteFile saves and caches a file report under its SHA-256 and returns it as read back from the DB
+func (w *ReportWriter) WriteFile(id, reportType string, vtResponse *models.VirusTotalFileResponse) (*models.FileReport, error) {
+	file := fileFromVT(id, reportType, vtResponse)
+
+	tx, err := w.db.Beginx()
+	if err != nil {
+		log.Printf("Error beginning transaction for ID %s: %v", id, err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := repositories.SaveFile(tx, file); err != nil {
+		log.Printf("Error saving file data for ID %s: %v", id, err)
+		return nil, err
+	}
+	if err := repositories.SaveFileNames(tx, id, vtResponse.Data.Attributes.Names); err != nil {
+		log.Printf("Error saving file names for ID %s: %v", id, err)
+		return nil, err
+	}
+	if err := repositories.SaveFileAnalysisResults(tx, id, vtResponse.Data.Attributes.LastAnalysisResults); err != nil {
+		log.Printf("Error saving analysis results for ID %s: %v", id, err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction for ID %s: %v", id, err)
+		return nil, err
+	}
+	log.Printf("Successfully committed file report for ID: %s", id)
+
+	// Read back the normalized report so cache and DB responses have the same shape
+	report, err := repositories.GetFileReport(id, nil, w.db)
+	if err != nil {
+		log.Printf("Error loading file report from DB for ID %s: %v", id, err)
+		return nil, err
+	}
+	cacheFileReport(report, w.opts.cacheTTL(reportType, report.File.MaliciousCount, report.File.SuspiciousCount), w.redisClient)
+	return report, nil
+}
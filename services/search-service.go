@@ -0,0 +1,111 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/repositories"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrInvalidSearch is returned for search filters or sort orders the search endpoints do not support
+var ErrInvalidSearch = errors.New("invalid search")
+
+// SearchIPs lists stored IPs matching the search. It reads Postgres only and never calls VirusTotal.
+func SearchIPs(search models.IPSearch, db *sqlx.DB) ([]models.IPAddress, error) {
+	if _, ok := repositories.IPSortOrders[search.Sort]; !ok {
+		return nil, fmt.Errorf("%w: sort must be one of %s", ErrInvalidSearch, sortValues(repositories.IPSortOrders))
+	}
+	ips, err := repositories.SearchIPAddresses(search, db)
+	if err != nil {
+		log.Printf("Error searching IPs: %v", err)
+		return nil, err
+	}
+	return ips, nil
+}
+
+// domainCursor is the position after the last row of a GET /domains page, sent to clients base64-encoded
+type domainCursor struct {
+	Sort string `json:"sort"`
+	Key  string `json:"key"`
+	ID   string `json:"id"`
+}
+
+// SearchDomains lists stored domains matching the search, one page after cursor.
+// It returns the cursor of the next page, or "" on the last page. Postgres only, VirusTotal is never called.
+func SearchDomains(search models.DomainSearch, cursor string, db *sqlx.DB) ([]models.DomainSearchResult, string, error) {
+	order, ok := repositories.DomainSortOrders[search.Sort]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: sort must be one of %s", ErrInvalidSearch, sortValues(repositories.DomainSortOrders))
+	}
+	if cursor != "" {
+		after, err := decodeDomainCursor(cursor, search.Sort, order.KeyType)
+		if err != nil {
+			return nil, "", err
+		}
+		search.AfterKey, search.AfterID = &after.Key, &after.ID
+	}
+
+	// Fetch one extra row to know whether there is a next page
+	limit := search.Limit
+	search.Limit++
+	domains, err := repositories.SearchDomains(search, db)
+	if err != nil {
+		log.Printf("Error searching domains: %v", err)
+		return nil, "", err
+	}
+	if len(domains) <= limit {
+		return domains, "", nil
+	}
+	domains = domains[:limit]
+	last := domains[limit-1]
+	return domains, encodeDomainCursor(domainCursor{Sort: search.Sort, Key: last.SortKey, ID: last.ID}), nil
+}
+
+func encodeDomainCursor(cursor domainCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeDomainCursor rejects cursors that were not issued for this sort order or do not hold a key of its type
+func decodeDomainCursor(s, sort, keyType string) (*domainCursor, error) {
+	invalid := fmt.Errorf("%w: cursor is invalid or belongs to another sort order", ErrInvalidSearch)
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, invalid
+	}
+	var cursor domainCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != sort || cursor.ID == "" {
+		return nil, invalid
+	}
+	switch keyType {
+	case "integer":
+		if _, err := strconv.Atoi(cursor.Key); err != nil {
+			return nil, invalid
+		}
+	case "timestamp":
+		if _, err := time.Parse("2006-01-02 15:04:05.999999", cursor.Key); err != nil && cursor.Key != "infinity" && cursor.Key != "-infinity" {
+			return nil, invalid
+		}
+	}
+	return &cursor, nil
+}
+
+// sortValues lists the keys of a sort order map for error messages
+func sortValues[T any](orders map[string]T) string {
+	values := make([]string, 0, len(orders))
+	for value := range orders {
+		values = append(values, value)
+	}
+	slices.Sort(values)
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestDecodeDomainCursor(t *testing.T) {
+	raw := func(json string) string { return base64.RawURLEncoding.EncodeToString([]byte(json)) }
+
+	tests := []struct {
+		name    string
+		cursor  string
+		sort    string
+		keyType string
+		want    domainCursor
+		wantErr bool
+	}{
+		{
+			name:    "timestamp key",
+			cursor:  encodeDomainCursor(domainCursor{Sort: "-creation_date", Key: "2024-05-01 12:30:00.123456", ID: "example.com"}),
+			sort:    "-creation_date",
+			keyType: "timestamp",
+			want:    domainCursor{Sort: "-creation_date", Key: "2024-05-01 12:30:00.123456", ID: "example.com"},
+		},
+		{
+			name:    "infinity stands in for a missing date",
+			cursor:  encodeDomainCursor(domainCursor{Sort: "expiration_date", Key: "infinity", ID: "example.com"}),
+			sort:    "expiration_date",
+			keyType: "timestamp",
+			want:    domainCursor{Sort: "expiration_date", Key: "infinity", ID: "example.com"},
+		},
+		{
+			name:    "-infinity stands in for a missing date",
+			cursor:  encodeDomainCursor(domainCursor{Sort: "-expiration_date", Key: "-infinity", ID: "example.com"}),
+			sort:    "-expiration_date",
+			keyType: "timestamp",
+			want:    domainCursor{Sort: "-expiration_date", Key: "-infinity", ID: "example.com"},
+		},
+		{
+			name:    "integer key",
+			cursor:  encodeDomainCursor(domainCursor{Sort: "-reputation", Key: "-2147483648", ID: "example.com"}),
+			sort:    "-reputation",
+			keyType: "integer",
+			want:    domainCursor{Sort: "-reputation", Key: "-2147483648", ID: "example.com"},
+		},
+		{
+			name:    "text key",
+			cursor:  encodeDomainCursor(domainCursor{Sort: "id", Key: "example.com", ID: "example.com"}),
+			sort:    "id",
+			keyType: "text",
+			want:    domainCursor{Sort: "id", Key: "example.com", ID: "example.com"},
+		},
+		{
+			name:    "other sort order",
+			cursor:  encodeDomainCursor(domainCursor{Sort: "creation_date", Key: "2024-05-01 12:30:00", ID: "example.com"}),
+			sort:    "-creation_date",
+			keyType: "timestamp",
+			wantErr: true,
+		},
+		{
+			name:    "key of another type",
+			cursor:  encodeDomainCursor(domainCursor{Sort: "reputation", Key: "2024-05-01 12:30:00", ID: "example.com"}),
+			sort:    "reputation",
+			keyType: "integer",
+			wantErr: true,
+		},
+		{
+			name:    "malformed timestamp",
+			cursor:  encodeDomainCursor(domainCursor{Sort: "creation_date", Key: "2024-05-01T12:30:00Z", ID: "example.com"}),
+			sort:    "creation_date",
+			keyType: "timestamp",
+			wantErr: true,
+		},
+		{
+			name:    "missing id",
+			cursor:  encodeDomainCursor(domainCursor{Sort: "id", Key: "example.com"}),
+			sort:    "id",
+			keyType: "text",
+			wantErr: true,
+		},
+		{
+			name:    "not base64",
+			cursor:  "not a cursor!",
+			sort:    "id",
+			keyType: "text",
+			wantErr: true,
+		},
+		{
+			name:    "not JSON",
+			cursor:  raw("sort=id"),
+			sort:    "id",
+			keyType: "text",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := decodeDomainCursor(tt.cursor, tt.sort, tt.keyType)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidSearch) {
+				t.Errorf("%s: decodeDomainCursor error = %v, want ErrInvalidSearch", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: decodeDomainCursor unexpected error: %v", tt.name, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("%s: decodeDomainCursor = %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/repositories"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// FetchHistory returns the snapshots of a domain or IP fetched within [from, to], newest first
+func FetchHistory(id, reportType string, from, to time.Time, limit int, db *sqlx.DB) (any, error) {
+	log.Printf("Starting FetchHistory for ID: %s, Type: %s, From: %v, To: %v", id, reportType, from, to)
+
+	switch reportType {
+	case "domains":
+		return repositories.GetDomainSnapshots(id, from, to, limit, db)
+	case "ip_addresses":
+		return repositories.GetIPSnapshots(id, from, to, limit, db)
+	}
+	return nil, fmt.Errorf("history is not supported for %s", reportType)
+}
+
+// domainSnapshot builds the history row of a domain fetch
+func domainSnapshot(domain *models.Domain, details *models.DomainDetails, vtResponse *models.VirusTotalDomainResponse) *models.DomainSnapshot {
+	var certificate struct {
+		Thumbprint string `json:"thumbprint_sha256"`
+	}
+	var thumbprint *string
+	if err := json.Unmarshal(details.LastHTTPSCertificate, &certificate); err == nil && certificate.Thumbprint != "" {
+		thumbprint = &certificate.Thumbprint
+	}
+
+	return &models.DomainSnapshot{
+		DomainID:              domain.ID,
+		FetchedAt:             domain.UpdatedAt,
+		LastAnalysisDate:      domain.LastAnalysisDate,
+		Reputation:            domain.Reputation,
+		HarmlessCount:         domain.HarmlessCount,
+		MaliciousCount:        domain.MaliciousCount,
+		SuspiciousCount:       domain.SuspiciousCount,
+		UndetectedCount:       domain.UndetectedCount,
+		TimeoutCount:          domain.TimeoutCount,
+		Verdicts:              verdictsJSON(vtResponse.Data.Attributes.LastAnalysisResults),
+		DNSRecords:            details.LastDNSRecords,
+		CertificateThumbprint: thumbprint,
+		ResponseHash:          responseHash(vtResponse),
+	}
+}
+
+// ipSnapshot builds the history row of an IP fetch
+func ipSnapshot(ip *models.IPAddress, vtResponse *models.VirusTotalIPResponse) *models.IPSnapshot {
+	tags := vtResponse.Data.Attributes.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	tagsJSON, _ := json.Marshal(tags)
+
+	return &models.IPSnapshot{
+		IPID:             ip.ID,
+		FetchedAt:        ip.UpdatedAt,
+		LastAnalysisDate: ip.LastAnalysisDate,
+		Reputation:       ip.Reputation,
+		HarmlessCount:    ip.HarmlessCount,
+		MaliciousCount:   ip.MaliciousCount,
+		SuspiciousCount:  ip.SuspiciousCount,
+		UndetectedCount:  ip.UndetectedCount,
+		TimeoutCount:     ip.TimeoutCount,
+		Verdicts:         verdictsJSON(vtResponse.Data.Attributes.LastAnalysisResults),
+		Tags:             tagsJSON,
+		ResponseHash:     responseHash(vtResponse),
+	}
+}
+
+// verdictsJSON reduces engine results to the engine -> category set kept in snapshots
+func verdictsJSON(results map[string]models.EngineResult) []byte {
+	verdicts := make(map[string]string, len(results))
+	for engine, result := range results {
+		verdicts[engine] = result.Category
+	}
+	verdictsJSON, _ := json.Marshal(verdicts)
+	return verdictsJSON
+}
+
+// responseHash is the SHA-256 of the decoded VT response. Map keys marshal sorted, so equal responses hash equally.
+func responseHash(vtResponse any) string {
+	responseJSON, _ := json.Marshal(vtResponse)
+	sum := sha256.Sum256(responseJSON)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/redis"
+	"vt-data-pipeline/repositories"
+	"vt-data-pipeline/vtclient"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// FetchURLReport returns the report of a URL. The URL is stored and cached under its VirusTotal identifier.
+func FetchURLReport(rawURL, reportType string, db *sqlx.DB, redisClient *redis.Client, vtClient vtclient.Client, opts FetchOptions) (*models.URLReport, error) {
+	id := vtclient.URLIdentifier(rawURL)
+	log.Printf("Starting FetchURLReport for URL: %s, ID: %s, Type: %s", rawURL, id, reportType)
+
+	// Check Redis cache first, unless the caller asked for a refresh or a tighter max age
+	cacheKey := fmt.Sprintf("url:%s", id)
+	readCache := func() (*models.URLReport, error) {
+		if opts.ForceRefresh {
+			return nil, nil
+		}
+		report, err := getCachedURLReport(cacheKey, redisClient)
+		if err != nil || report == nil || !opts.isFresh(reportType, report.URL.UpdatedAt, report.URL.MaliciousCount, report.URL.SuspiciousCount) {
+			return nil, err
+		}
+		return report, nil
+	}
+	report, err := readCache()
+	if err != nil {
+		log.Printf("Error unmarshaling cached data for ID %s: %v", id, err)
+		return nil, err
+	}
+	if report != nil {
+		log.Printf("Redis cache hit for ID: %s", id)
+		return report, nil
+	}
+	log.Printf("Redis cache miss for ID: %s, proceeding with API call", id)
+
+	// Only one DB/VT fetch per indicator runs at a time, in this process and across replicas
+	return fetchOnce(opts.fetchKey(cacheKey), redisClient,
+		readCache,
+		func() (*models.URLReport, error) {
+			return loadURLReport(id, rawURL, reportType, cacheKey, db, redisClient, vtClient, opts)
+		})
+}
+
+// loadURLReport loads a fresh report from the DB, or fetches it from VirusTotal and persists it
+func loadURLReport(id, rawURL, reportType, cacheKey string, db *sqlx.DB, redisClient *redis.Client, vtClient vtclient.Client, opts FetchOptions) (*models.URLReport, error) {
+	// Check database for data within the freshness policy, unless the caller asked for a refresh
+	if !opts.ForceRefresh {
+		urlFromDB, err := repositories.GetURL(id, db)
+		if err == nil && urlFromDB != nil {
+			if opts.isFresh(reportType, urlFromDB.UpdatedAt, urlFromDB.MaliciousCount, urlFromDB.SuspiciousCount) {
+				log.Printf("Found recent URL data in DB for ID: %s, updated at: %v", id, urlFromDB.UpdatedAt)
+				report, err := repositories.GetURLReport(id, nil, db)
+				if err != nil {
+					log.Printf("Error loading URL report from DB for ID %s: %v", id, err)
+					return nil, err
+				}
+				cacheURLReport(cacheKey, report, opts.cacheTTL(reportType, report.URL.MaliciousCount, report.URL.SuspiciousCount), redisClient)
+				return report, nil
+			}
+			if opts.serveStale(urlFromDB.UpdatedAt) {
+				log.Printf("Serving stale URL data for ID: %s, updated at: %v, refreshing in the background", id, urlFromDB.UpdatedAt)
+				report, err := repositories.GetURLReport(id, nil, db)
+				if err != nil {
+					log.Printf("Error loading URL report from DB for ID %s: %v", id, err)
+					return nil, err
+				}
+				opts.revalidate(cacheKey, reportType, rawURL, redisClient)
+				return report, nil
+			}
+			log.Printf("DB data for ID %s is stale (updated at: %v), proceeding with API call", id, urlFromDB.UpdatedAt)
+		} else if err != nil {
+			log.Printf("No URL data found in DB for ID %s or error: %v", id, err)
+		}
+	}
+
+	// Skip indicators VirusTotal recently reported as unknown
+	if err := checkNotFound(cacheKey, reportType, id, opts, db, redisClient); err != nil {
+		return nil, err
+	}
+
+	// Fetch from VirusTotal API
+	log.Printf("Making API request to VirusTotal for ID: %s", id)
+	vtResponse, err := vtClient.GetURL(context.Background(), id)
+	if err != nil {
+		log.Printf("Error fetching VirusTotal report for ID %s: %v", id, err)
+		recordNotFound(err, cacheKey, reportType, id, opts, db, redisClient)
+		return nil, err
+	}
+	log.Printf("Successfully decoded API response for ID: %s", id)
+
+	if vtResponse.Data.Attributes.URL == "" {
+		vtResponse.Data.Attributes.URL = rawURL
+	}
+
+	// Persist in one transaction, the writer caches the report after commit
+	return NewReportWriter(db, redisClient, opts).WriteURL(id, reportType, cacheKey, vtResponse)
+}
+
+// urlFromVT converts a VirusTotal URL response into the urls and url_details rows
+func urlFromVT(id, reportType string, vtResponse *models.VirusTotalURLResponse) (*models.URL, *models.URLDetails) {
+	attributes := vtResponse.Data.Attributes
+
+	// Get analysis stats
+	harmless := attributes.LastAnalysisStats["harmless"]
+	malicious := attributes.LastAnalysisStats["malicious"]
+	suspicious := attributes.LastAnalysisStats["suspicious"]
+	undetected := attributes.LastAnalysisStats["undetected"]
+	timeout := attributes.LastAnalysisStats["timeout"]
+
+	// Create URL object
+	url := &models.URL{
+		ID:                   id,
+		Type:                 reportType,
+		URL:                  attributes.URL,
+		LastFinalURL:         &attributes.LastFinalURL,
+		Title:                &attributes.Title,
+		FirstSubmissionDate:  unixTime(attributes.FirstSubmissionDate),
+		LastSubmissionDate:   unixTime(attributes.LastSubmissionDate),
+		LastAnalysisDate:     unixTime(attributes.LastAnalysisDate),
+		Reputation:           &attributes.Reputation,
+		TimesSubmitted:       &attributes.TimesSubmitted,
+		LastHTTPResponseCode: &attributes.LastHTTPResponseCode,
+		HarmlessCount:        &harmless,
+		MaliciousCount:       &malicious,
+		SuspiciousCount:      &suspicious,
+		UndetectedCount:      &undetected,
+		TimeoutCount:         &timeout,
+		CreatedAt:            time.Now(),
+		UpdatedAt:            time.Now(),
+	}
+
+	// Collect URL details
+	categoriesJSON, _ := json.Marshal(attributes.Categories)
+	tagsJSON, _ := json.Marshal(attributes.Tags)
+	threatNamesJSON, _ := json.Marshal(attributes.ThreatNames)
+	redirectionJSON, _ := json.Marshal(attributes.RedirectionChain)
+	headersJSON, _ := json.Marshal(attributes.LastHTTPResponseHeaders)
+	linksJSON, _ := json.Marshal(attributes.OutgoingLinks)
+	metaJSON, _ := json.Marshal(attributes.HTMLMeta)
+	votesJSON, _ := json.Marshal(attributes.TotalVotes)
+
+	details := &models.URLDetails{
+		URLID:                   id,
+		Categories:              categoriesJSON,
+		Tags:                    tagsJSON,
+		ThreatNames:             threatNamesJSON,
+		RedirectionChain:        redirectionJSON,
+		LastHTTPResponseHeaders: headersJSON,
+		OutgoingLinks:           linksJSON,
+		HTMLMeta:                metaJSON,
+		TotalVotes:              votesJSON,
+	}
+
+	return url, details
+}
+
+// unixTime converts a VirusTotal epoch timestamp, where 0 means unknown
+func unixTime(epoch int64) *time.Time {
+	if epoch == 0 {
+		return nil
+	}
+	t := time.Unix(epoch, 0)
+	return &t
+}
+
+// cacheURLReport stores the full URL report in Redis
+func cacheURLReport(cacheKey string, report *models.URLReport, ttl time.Duration, redisClient *redis.Client) {
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		log.Printf("Error marshaling URL report for cache: %v", err)
+		return
+	}
+	if err := redisClient.Set(context.Background(), cacheKey, reportJSON, ttl); err != nil {
+		log.Printf("Error saving to Redis cache: %v", err)
+		return
+	}
+	log.Printf("Successfully saved to Redis cache for key: %s", cacheKey)
+}
+
+// getCachedURLReport returns the cached report, or nil on a cache miss
+func getCachedURLReport(cacheKey string, redisClient *redis.Client) (*models.URLReport, error) {
+	cachedData, err := redisClient.Get(context.Background(), cacheKey)
+	if err != nil || cachedData == "" {
+		return nil, nil
+	}
+	var report models.URLReport
+	if err := json.Unmarshal([]byte(cachedData), &report); err != nil {
+		return nil, err
+	}
+	if report.URL == nil {
+		return nil, nil
+	}
+	return &report, nil
+}
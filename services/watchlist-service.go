@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"vt-data-pipeline/indicator"
+	"vt-data-pipeline/jobs"
+	"vt-data-pipeline/models"
+	"vt-data-pipeline/redis"
+	"vt-data-pipeline/repositories"
+	"vt-data-pipeline/vtclient"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MinWatchInterval is the shortest refresh interval accepted for a watched indicator
+const MinWatchInterval = time.Hour
+
+// ErrInvalidWatch is returned for watchlist entries with an unsupported type or interval
+var ErrInvalidWatch = errors.New("watchlist entries need type domains or ip_addresses and an interval of at least 1h")
+
+// ErrNotWatched is returned when removing an indicator that is not on the watchlist
+var ErrNotWatched = errors.New("indicator is not on the watchlist")
+
+// watchlistLockKey makes sure only one replica schedules refreshes per tick
+const watchlistLockKey = "lock:watchlist-scheduler"
+
+// watchlistPendingKey is a sorted set of the scheduled refresh jobs that have not called VirusTotal yet,
+// scored by enqueue time. Their requests are not in the remaining quota yet, so the scheduler subtracts them.
+const watchlistPendingKey = "watchlist:pending"
+
+// watchlistPendingMaxAge drops pending entries of jobs that will never run, matching how long jobs live
+const watchlistPendingMaxAge = 24 * time.Hour
+
+// GetWatchlist returns all watched indicators
+func GetWatchlist(db *sqlx.DB) ([]models.WatchlistEntry, error) {
+	return repositories.GetWatchlist(db)
+}
+
+// AddToWatchlist watches an indicator, re-fetching it every interval
+func AddToWatchlist(id, reportType string, interval time.Duration, db *sqlx.DB) (*models.WatchlistEntry, error) {
+	if id == "" || (reportType != "domains" && reportType != "ip_addresses") || interval < MinWatchInterval {
+		return nil, ErrInvalidWatch
+	}
+	id, err := indicator.Normalize(reportType, id)
+	if err != nil {
+		return nil, err
+	}
+	return repositories.SaveWatchlistEntry(id, reportType, interval, db)
+}
+
+// RemoveFromWatchlist stops watching an indicator
+func RemoveFromWatchlist(id, reportType string, db *sqlx.DB) error {
+	if normalized, err := indicator.Normalize(reportType, id); err == nil {
+		id = normalized
+	}
+	deleted, err := repositories.DeleteWatchlistEntry(id, reportType, db)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrNotWatched
+	}
+	return nil
+}
+
+// WatchlistScheduler queues refresh jobs for due watchlist entries.
+// Each tick it spends at most the share of the pool's remaining daily quota that is not reserved for interactive requests.
+type WatchlistScheduler struct {
+	db            *sqlx.DB
+	redisClient   *redis.Client
+	keyPool       *vtclient.KeyPool
+	queue         *jobs.Queue
+	tick          time.Duration
+	budgetPercent int
+}
+
+// NewWatchlistScheduler creates a scheduler that runs every tick and may use budgetPercent of the daily VT quota
+func NewWatchlistScheduler(db *sqlx.DB, redisClient *redis.Client, keyPool *vtclient.KeyPool, queue *jobs.Queue, tick time.Duration, budgetPercent int) *WatchlistScheduler {
+	return &WatchlistScheduler{
+		db:            db,
+		redisClient:   redisClient,
+		keyPool:       keyPool,
+		queue:         queue,
+		tick:          tick,
+		budgetPercent: budgetPercent,
+	}
+}
+
+// Run schedules refreshes every tick until ctx is cancelled
+func (s *WatchlistScheduler) Run(ctx context.Context) {
+	log.Printf("Watchlist scheduler started, tick: %v, budget: %d%% of the daily VT quota", s.tick, s.budgetPercent)
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+
+	for {
+		if err := s.schedule(ctx); err != nil {
+			log.Printf("Error scheduling watchlist refreshes: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("Watchlist scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// schedule queues the highest priority due entries that fit into the watchlist's share of the remaining quota
+func (s *WatchlistScheduler) schedule(ctx context.Context) error {
+	// Replicas all run the scheduler, the lock lets one of them do the work each tick
+	token, err := lockToken()
+	if err != nil {
+		return err
+	}
+	acquired, err := s.redisClient.SetNX(ctx, watchlistLockKey, token, s.tick*9/10)
+	if err != nil || !acquired {
+		return err
+	}
+
+	due, err := repositories.CountDueWatchlistEntries(s.db)
+	if err != nil || due == 0 {
+		return err
+	}
+
+	remaining, err := s.keyPool.RemainingToday(ctx)
+	if err != nil {
+		return err
+	}
+	pending, err := s.pendingRefreshes(ctx)
+	if err != nil {
+		return err
+	}
+	reserve := s.keyPool.DailyBudget() * (100 - s.budgetPercent) / 100
+	allowance := remaining - reserve - pending
+	if allowance <= 0 {
+		log.Printf("Watchlist has %d due entries but only %d VT requests are left today with %d refreshes still queued, %d are reserved for users", due, remaining, pending, reserve)
+		return nil
+	}
+
+	entries, err := repositories.GetDueWatchlistEntries(allowance, s.db)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		job, err := s.queue.EnqueueScheduled(ctx, entry.Type, entry.Indicator)
+		if err != nil {
+			return err
+		}
+		if err := s.redisClient.ZAdd(ctx, watchlistPendingKey, float64(time.Now().Unix()), job.ID); err != nil {
+			return err
+		}
+		if err := repositories.MarkWatchlistEnqueued(entry.ID, s.db); err != nil {
+			return err
+		}
+	}
+	log.Printf("Watchlist scheduler queued %d of %d due entries (%d VT requests left today, %d refreshes still queued, %d reserved)", len(entries), due, remaining, pending, reserve)
+	return nil
+}
+
+// pendingRefreshes counts the scheduled refresh jobs that have not called VirusTotal yet
+func (s *WatchlistScheduler) pendingRefreshes(ctx context.Context) (int, error) {
+	expired := strconv.FormatInt(time.Now().Add(-watchlistPendingMaxAge).Unix(), 10)
+	if err := s.redisClient.ZRemRangeByScore(ctx, watchlistPendingKey, "-inf", expired); err != nil {
+		return 0, err
+	}
+	pending, err := s.redisClient.ZCard(ctx, watchlistPendingKey)
+	return int(pending), err
+}
+
+// finishScheduledRefresh removes a scheduled refresh job from the pending set once it has called VirusTotal
+func finishScheduledRefresh(ctx context.Context, jobID string, redisClient *redis.Client) {
+	if err := redisClient.ZRem(ctx, watchlistPendingKey, jobID); err != nil {
+		log.Printf("Error removing job %s from the pending watchlist refreshes: %v", jobID, err)
+	}
+}
@@ -0,0 +1,159 @@
+package vtclient
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"vt-data-pipeline/models"
+)
+
+// BaseURL is the VirusTotal API v3 root
+const BaseURL = "https://www.virustotal.com/api/v3"
+
+// Client fetches reports from the VirusTotal API
+type Client interface {
+	GetDomain(ctx context.Context, id string) (*models.VirusTotalDomainResponse, error)
+	GetIP(ctx context.Context, id string) (*models.VirusTotalIPResponse, error)
+	GetURL(ctx context.Context, id string) (*models.VirusTotalURLResponse, error)
+	GetFile(ctx context.Context, hash string) (*models.VirusTotalFileResponse, error)
+	GetRelationship(ctx context.Context, collection, id, relationship, cursor string, limit int) (*models.VirusTotalRelationshipResponse, error)
+}
+
+// URLIdentifier returns the VirusTotal identifier of a URL, its unpadded base64url encoding
+func URLIdentifier(rawURL string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(rawURL))
+}
+
+type httpClient struct {
+	baseURL    string
+	pool       *KeyPool
+	httpClient *http.Client
+}
+
+// NewClient creates a VirusTotal client that spreads its requests over the keys of the pool.
+// Every request takes a token from the chosen key's budget first, so all clients sharing the pool share its quota.
+func NewClient(pool *KeyPool) Client {
+	return &httpClient{
+		baseURL:    BaseURL,
+		pool:       pool,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// GetDomain fetches the domain object from /domains/{id}
+func (c *httpClient) GetDomain(ctx context.Context, id string) (*models.VirusTotalDomainResponse, error) {
+	var response models.VirusTotalDomainResponse
+	if err := c.get(ctx, "/domains/"+url.PathEscape(id), &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetIP fetches the IP address object from /ip_addresses/{id}
+func (c *httpClient) GetIP(ctx context.Context, id string) (*models.VirusTotalIPResponse, error) {
+	var response models.VirusTotalIPResponse
+	if err := c.get(ctx, "/ip_addresses/"+url.PathEscape(id), &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetURL fetches the URL object from /urls/{id}, where id is the URLIdentifier of the URL
+func (c *httpClient) GetURL(ctx context.Context, id string) (*models.VirusTotalURLResponse, error) {
+	var response models.VirusTotalURLResponse
+	if err := c.get(ctx, "/urls/"+url.PathEscape(id), &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetFile fetches the file object from /files/{hash}, where hash is its MD5, SHA-1 or SHA-256
+func (c *httpClient) GetFile(ctx context.Context, hash string) (*models.VirusTotalFileResponse, error) {
+	var response models.VirusTotalFileResponse
+	if err := c.get(ctx, "/files/"+url.PathEscape(hash), &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetRelationship fetches one page of related objects from /{collection}/{id}/{relationship}.
+// Pass the previous page's meta.cursor to continue, an empty cursor starts from the first page.
+func (c *httpClient) GetRelationship(ctx context.Context, collection, id, relationship, cursor string, limit int) (*models.VirusTotalRelationshipResponse, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(limit))
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	path := "/" + collection + "/" + url.PathEscape(id) + "/" + relationship + "?" + query.Encode()
+
+	var response models.VirusTotalRelationshipResponse
+	if err := c.get(ctx, path, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// get performs a GET with a key from the pool and decodes a successful response into out.
+// A key rejected or throttled by VT is quarantined and the request is retried with the next key.
+func (c *httpClient) get(ctx context.Context, path string, out any) error {
+	var err error
+	for attempt := 0; attempt < c.pool.Size(); attempt++ {
+		var key Key
+		key, err = c.pool.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = c.do(ctx, key, path, out)
+		c.pool.Report(ctx, key, err)
+		if !errors.Is(err, ErrWrongCredentials) && !errors.Is(err, ErrQuotaExceeded) {
+			return err
+		}
+	}
+	return err
+}
+
+// do performs a single authenticated GET. Non-2xx responses are returned as *APIError.
+func (c *httpClient) do(ctx context.Context, key Key, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-apikey", key.Value)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("virustotal: request %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("virustotal: decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// decodeError turns a non-2xx response into an *APIError, falling back to the HTTP status when the body is not the VT error envelope
+func decodeError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var envelope errorResponse
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Error.Code == "" {
+		return &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	}
+	envelope.Error.StatusCode = resp.StatusCode
+	return &envelope.Error
+}
@@ -0,0 +1,52 @@
+package vtclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Sentinel errors for the VirusTotal error codes the pipeline reacts to.
+// Match them with errors.Is against errors returned by a Client.
+var (
+	ErrNotFound         = errors.New("virustotal: not found")
+	ErrQuotaExceeded    = errors.New("virustotal: quota exceeded")
+	ErrWrongCredentials = errors.New("virustotal: wrong credentials")
+)
+
+// VirusTotal error codes, see https://docs.virustotal.com/reference/errors
+const (
+	CodeNotFound         = "NotFoundError"
+	CodeQuotaExceeded    = "QuotaExceededError"
+	CodeWrongCredentials = "WrongCredentialsError"
+	CodeTooManyRequests  = "TooManyRequestsError"
+)
+
+// APIError is an error returned by the VirusTotal API
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+// errorResponse is the error envelope of the VirusTotal API
+type errorResponse struct {
+	Error APIError `json:"error"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("virustotal: %s (HTTP %d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// Is maps the VirusTotal error code onto the package sentinel errors
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Code == CodeNotFound || (e.Code == "" && e.StatusCode == http.StatusNotFound)
+	case ErrQuotaExceeded:
+		return e.Code == CodeQuotaExceeded || e.Code == CodeTooManyRequests || (e.Code == "" && e.StatusCode == http.StatusTooManyRequests)
+	case ErrWrongCredentials:
+		return e.Code == CodeWrongCredentials || (e.Code == "" && e.StatusCode == http.StatusUnauthorized)
+	}
+	return false
+}
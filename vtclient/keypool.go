@@ -0,0 +1,235 @@
+package vtclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"vt-data-pipeline/ratelimit"
+	"vt-data-pipeline/redis"
+)
+
+// Key is a VirusTotal API key with its own quota
+type Key struct {
+	Value  string
+	Tier   string
+	Budget ratelimit.Budget
+}
+
+// ID is a stable, non-secret fingerprint of the key used in Redis keys and the admin endpoint
+func (k Key) ID() string {
+	sum := sha256.Sum256([]byte(k.Value))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Masked returns the key with everything but its first and last four characters hidden
+func (k Key) Masked() string {
+	if len(k.Value) <= 8 {
+		return "****"
+	}
+	return k.Value[:4] + "..." + k.Value[len(k.Value)-4:]
+}
+
+// KeyUsage is the quota and usage state of one key in the pool
+type KeyUsage struct {
+	ID               string               `json:"id"`
+	Key              string               `json:"key"`
+	Tier             string               `json:"tier"`
+	Remaining        *ratelimit.Remaining `json:"remaining,omitempty"`
+	QuarantineReason string               `json:"quarantine_reason,omitempty"`
+	QuarantinedUntil *time.Time           `json:"quarantined_until,omitempty"`
+	Counters         map[string]int64     `json:"counters"`
+}
+
+// KeyPool rotates requests across several API keys.
+// Quota and quarantine state live in Redis so that all replicas see the same pool.
+type KeyPool struct {
+	keys                 []Key
+	limiter              *ratelimit.Limiter
+	redisClient          *redis.Client
+	credentialQuarantine time.Duration
+	quotaQuarantine      time.Duration
+}
+
+// NewKeyPool creates a KeyPool. Keys rejected by VT are quarantined for credentialQuarantine,
+// keys that hit their VT quota for quotaQuarantine.
+func NewKeyPool(keys []Key, limiter *ratelimit.Limiter, redisClient *redis.Client, credentialQuarantine, quotaQuarantine time.Duration) *KeyPool {
+	return &KeyPool{
+		keys:                 keys,
+		limiter:              limiter,
+		redisClient:          redisClient,
+		credentialQuarantine: credentialQuarantine,
+		quotaQuarantine:      quotaQuarantine,
+	}
+}
+
+// Size returns the number of keys in the pool
+func (p *KeyPool) Size() int {
+	return len(p.keys)
+}
+
+// Acquire picks a key that is not quarantined, preferring the one with the most remaining daily quota,
+// and takes a token from its budget
+func (p *KeyPool) Acquire(ctx context.Context) (Key, error) {
+	type candidate struct {
+		key       Key
+		remaining int
+	}
+
+	var candidates []candidate
+	shortestQuarantine := time.Duration(0)
+	for _, key := range p.keys {
+		ttl, err := p.redisClient.TTL(ctx, quarantineKey(key))
+		if err != nil {
+			return Key{}, err
+		}
+		if ttl > 0 {
+			if shortestQuarantine == 0 || ttl < shortestQuarantine {
+				shortestQuarantine = ttl
+			}
+			continue
+		}
+
+		remaining, err := p.limiter.Remaining(ctx, key.ID(), key.Budget)
+		if err != nil {
+			return Key{}, err
+		}
+		candidates = append(candidates, candidate{key: key, remaining: remaining.Day})
+	}
+
+	if len(candidates) == 0 {
+		return Key{}, &ratelimit.QuotaExhaustedError{RetryAfter: shortestQuarantine}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].remaining > candidates[j].remaining
+	})
+
+	buckets := make([]ratelimit.Bucket, len(candidates))
+	for i, c := range candidates {
+		buckets[i] = ratelimit.Bucket{Name: c.key.ID(), Budget: c.key.Budget}
+	}
+	i, err := p.limiter.Wait(ctx, buckets...)
+	if err != nil {
+		return Key{}, err
+	}
+	return candidates[i].key, nil
+}
+
+// Report records the outcome of a request made with key and quarantines keys VT rejected or throttled
+func (p *KeyPool) Report(ctx context.Context, key Key, err error) {
+	counter := "success"
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrWrongCredentials):
+		counter = "wrong_credentials"
+		p.quarantine(ctx, key, CodeWrongCredentials, p.credentialQuarantine)
+	case errors.Is(err, ErrQuotaExceeded):
+		counter = "quota_exceeded"
+		p.quarantine(ctx, key, CodeQuotaExceeded, p.quotaQuarantine)
+	case errors.Is(err, ErrNotFound):
+		counter = "not_found"
+	default:
+		counter = "errors"
+	}
+
+	for _, field := range []string{"requests", counter} {
+		if err := p.redisClient.HIncrBy(ctx, usageKey(key), field, 1); err != nil {
+			log.Printf("Error updating usage counters for VT key %s: %v", key.ID(), err)
+		}
+	}
+}
+
+// Usage returns the quota, quarantine and usage counters of every key in the pool
+func (p *KeyPool) Usage(ctx context.Context) ([]KeyUsage, error) {
+	usage := make([]KeyUsage, 0, len(p.keys))
+	for _, key := range p.keys {
+		u := KeyUsage{
+			ID:       key.ID(),
+			Key:      key.Masked(),
+			Tier:     key.Tier,
+			Counters: map[string]int64{},
+		}
+
+		remaining, err := p.limiter.Remaining(ctx, key.ID(), key.Budget)
+		if err != nil {
+			return nil, err
+		}
+		u.Remaining = remaining
+
+		reason, err := p.redisClient.Get(ctx, quarantineKey(key))
+		if err == nil && reason != "" {
+			u.QuarantineReason = reason
+			if ttl, err := p.redisClient.TTL(ctx, quarantineKey(key)); err == nil && ttl > 0 {
+				until := time.Now().Add(ttl)
+				u.QuarantinedUntil = &until
+			}
+		}
+
+		counters, err := p.redisClient.HGetAll(ctx, usageKey(key))
+		if err != nil {
+			return nil, err
+		}
+		for field, value := range counters {
+			n, _ := strconv.ParseInt(value, 10, 64)
+			u.Counters[field] = n
+		}
+
+		usage = append(usage, u)
+	}
+	return usage, nil
+}
+
+// RemainingToday returns the daily quota left across the keys that are not quarantined
+func (p *KeyPool) RemainingToday(ctx context.Context) (int, error) {
+	total := 0
+	for _, key := range p.keys {
+		ttl, err := p.redisClient.TTL(ctx, quarantineKey(key))
+		if err != nil {
+			return 0, err
+		}
+		if ttl > 0 {
+			continue
+		}
+		remaining, err := p.limiter.Remaining(ctx, key.ID(), key.Budget)
+		if err != nil {
+			return 0, err
+		}
+		total += remaining.Day
+	}
+	return total, nil
+}
+
+// DailyBudget returns the sum of the daily quotas of all keys
+func (p *KeyPool) DailyBudget() int {
+	total := 0
+	for _, key := range p.keys {
+		total += key.Budget.PerDay
+	}
+	return total
+}
+
+// quarantine takes a key out of rotation for the given duration
+func (p *KeyPool) quarantine(ctx context.Context, key Key, reason string, duration time.Duration) {
+	if duration <= 0 {
+		return
+	}
+	log.Printf("Quarantining VT key %s for %s: %s", key.ID(), duration, reason)
+	if err := p.redisClient.Set(ctx, quarantineKey(key), reason, duration); err != nil {
+		log.Printf("Error quarantining VT key %s: %v", key.ID(), err)
+	}
+}
+
+func quarantineKey(key Key) string {
+	return fmt.Sprintf("vtkey:%s:quarantine", key.ID())
+}
+
+func usageKey(key Key) string {
+	return fmt.Sprintf("vtkey:%s:usage", key.ID())
+}
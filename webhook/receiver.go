@@ -0,0 +1,32 @@
+package webhook
+
+import (
+	"io"
+	"log"
+	"net/http"
+)
+
+// Receiver is a minimal webhook endpoint that verifies signatures and logs the payloads.
+// It is meant for trying out alert delivery locally.
+func Receiver(secret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if secret != "" {
+			if err := Verify(secret, r.Header, body); err != nil {
+				log.Printf("Rejected webhook from %s: %v", r.RemoteAddr, err)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+		log.Printf("Received webhook on %s: %s", r.URL.Path, body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	const secret = "s3cret"
+	body := []byte(`{"event":"indicator.alert"}`)
+	now := time.Now().Unix()
+	skew := int64(MaxSkew / time.Second)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      []byte
+		wantErr   bool
+	}{
+		{name: "valid", timestamp: strconv.FormatInt(now, 10), signature: Sign(secret, now, body), body: body},
+		{name: "just inside the skew in the past", timestamp: strconv.FormatInt(now-skew+5, 10), signature: Sign(secret, now-skew+5, body), body: body},
+		{name: "just inside the skew in the future", timestamp: strconv.FormatInt(now+skew-5, 10), signature: Sign(secret, now+skew-5, body), body: body},
+		{name: "too old", timestamp: strconv.FormatInt(now-skew-5, 10), signature: Sign(secret, now-skew-5, body), body: body, wantErr: true},
+		{name: "too far in the future", timestamp: strconv.FormatInt(now+skew+5, 10), signature: Sign(secret, now+skew+5, body), body: body, wantErr: true},
+		{name: "missing timestamp", signature: Sign(secret, now, body), body: body, wantErr: true},
+		{name: "non-numeric timestamp", timestamp: "yesterday", signature: Sign(secret, now, body), body: body, wantErr: true},
+		{name: "timestamp not covered by the signature", timestamp: strconv.FormatInt(now-1, 10), signature: Sign(secret, now, body), body: body, wantErr: true},
+		{name: "tampered body", timestamp: strconv.FormatInt(now, 10), signature: Sign(secret, now, body), body: []byte(`{"event":"other"}`), wantErr: true},
+		{name: "wrong secret", timestamp: strconv.FormatInt(now, 10), signature: Sign("other", now, body), body: body, wantErr: true},
+		{name: "missing signature", timestamp: strconv.FormatInt(now, 10), body: body, wantErr: true},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.timestamp != "" {
+			header.Set(TimestampHeader, tt.timestamp)
+		}
+		if tt.signature != "" {
+			header.Set(SignatureHeader, tt.signature)
+		}
+		if err := Verify(secret, header, tt.body); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Verify error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}